@@ -0,0 +1,125 @@
+package robolang
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ASTVersion is the current version of the JSON format produced by MarshalAST
+const ASTVersion = 1
+
+// AST is the JSON document that holds a serialised script
+type AST struct {
+	Nodes   []*Node `json:"nodes"`
+	Version int     `json:"version"`
+}
+
+// MarshalAST converts a list of nodes to a versioned JSON document
+func MarshalAST(nodes []*Node) ([]byte, error) {
+	return json.Marshal(&AST{
+		Nodes:   nodes,
+		Version: ASTVersion,
+	})
+}
+
+// UnmarshalAST converts a versioned JSON document back into a list of nodes
+func UnmarshalAST(data []byte) ([]*Node, error) {
+	ast := AST{}
+	if err := json.Unmarshal(data, &ast); err != nil {
+		return nil, err
+	}
+	if ast.Version < 1 || ast.Version > ASTVersion {
+		return nil, fmt.Errorf("Unsupported AST version %d", ast.Version)
+	}
+	for _, node := range ast.Nodes {
+		if node == nil {
+			return nil, fmt.Errorf("Missing node in AST")
+		}
+	}
+	return ast.Nodes, nil
+}
+
+// UnmarshalJSON converts JSON to a Node, restoring the node type and the parent links
+func (n *Node) UnmarshalJSON(data []byte) error {
+	type node Node
+	if err := json.Unmarshal(data, (*node)(n)); err != nil {
+		return err
+	}
+
+	value, err := lookupEnum(n.TypeText, "NodeType", func(i int) string { return NodeType(i).String() })
+	if err != nil {
+		return err
+	}
+	if n.Token == nil {
+		return fmt.Errorf("Missing token for %s", n.TypeText)
+	}
+	n.Type, n.last = NodeType(value), n.Token
+	for _, nodes := range [][]*Node{n.Args, n.Children} {
+		for _, child := range nodes {
+			if child == nil {
+				return fmt.Errorf("Missing child node for %s at line %d, pos %d", n.TypeText, n.Start.LineNum, n.Start.LinePos)
+			}
+			child.Parent = n
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON converts JSON to a Token, restoring the token type
+func (t *Token) UnmarshalJSON(data []byte) error {
+	type token Token
+	if err := json.Unmarshal(data, (*token)(t)); err != nil {
+		return err
+	}
+
+	value, err := lookupEnum(t.TypeName, "TokenType", func(i int) string { return TokenType(i).String() })
+	if err != nil {
+		return err
+	}
+	t.Type = TokenType(value)
+	return nil
+}
+
+// UnmarshalJSON converts JSON to a Quantity, restoring the unit family
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	type quantity Quantity
+	if err := json.Unmarshal(data, (*quantity)(q)); err != nil {
+		return err
+	}
+
+	value, err := lookupEnum(q.FamilyName, "UnitFamily", func(i int) string { return UnitFamily(i).String() })
+	if err != nil {
+		return err
+	}
+	q.Family = UnitFamily(value)
+	return nil
+}
+
+// UnmarshalJSON converts JSON to a ParameterDefinition, restoring the unit family
+func (param *ParameterDefinition) UnmarshalJSON(data []byte) error {
+	type parameter ParameterDefinition
+	if err := json.Unmarshal(data, (*parameter)(param)); err != nil {
+		return err
+	}
+
+	value, err := lookupEnum(param.UnitsText, "UnitFamily", func(i int) string { return UnitFamily(i).String() })
+	if err != nil {
+		return err
+	}
+	param.Units = UnitFamily(value)
+	return nil
+}
+
+// lookupEnum finds the value of an enum from its generated name.
+func lookupEnum(name, typeName string, toString func(int) string) (int, error) {
+	for value := 0; ; value++ {
+		text := toString(value)
+		if text == name {
+			return value, nil
+		}
+		if strings.HasPrefix(text, typeName+"(") {
+			return 0, fmt.Errorf("Unknown %s '%s'", typeName, name)
+		}
+	}
+}
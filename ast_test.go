@@ -0,0 +1,107 @@
+package robolang
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestASTRoundTrip(t *testing.T) {
+	tests := []string{
+		"clear()",
+		"set(variable=&count,value=1)\nsay(text=@hello)",
+		"## Moves forward\nwaitForInput():\n  move(distance=30cm, speed=5kph)\n  waitForTime(duration=1m30s)\n  say(text='You have {&count} stars')",
+	}
+	for _, input := range tests {
+		result := NewParser(input).Parse()
+		if len(result.Errors) > 0 {
+			t.Errorf("Unexpected errors while parsing `%s`: [%v]", input, result.Errors)
+			continue
+		}
+
+		data, err := MarshalAST(result.Nodes)
+		if err != nil {
+			t.Errorf("Unable to marshal `%s`: %v", input, err)
+			continue
+		}
+		nodes, err := UnmarshalAST(data)
+		if err != nil {
+			t.Errorf("Unable to unmarshal `%s`: %v", input, err)
+			continue
+		}
+
+		if expected, actual := nodesString(result.Nodes), nodesString(nodes); expected != actual {
+			t.Errorf("AST does not round trip for `%s`: expected [%s], got [%s]", input, expected, actual)
+		}
+		again, _ := MarshalAST(nodes)
+		if string(again) != string(data) {
+			t.Errorf("JSON does not round trip for `%s`: expected %s, got %s", input, data, again)
+		}
+	}
+}
+
+func TestASTRestoresTypes(t *testing.T) {
+	result := NewParser("move(distance=30cm)").Parse()
+	data, _ := MarshalAST(result.Nodes)
+	nodes, err := UnmarshalAST(data)
+	if err != nil {
+		t.Fatalf("Unable to unmarshal: %v", err)
+	}
+
+	move := nodes[0]
+	arg := move.Args[0]
+	value := arg.Children[0]
+	if move.Type != NodeFunction || move.Token.Type != TokenIdentifier {
+		t.Errorf("Unexpected types for function: %s, %s", move.Type.String(), move.Token.Type.String())
+	}
+	if value.Type != NodeConstant || value.Token.Type != TokenQuantity || value.Quantity.Family != UnitLength {
+		t.Errorf("Unexpected types for value: %s, %s", value.Type.String(), value.Token.Type.String())
+	}
+	if arg.Parent != move || value.Parent != arg {
+		t.Errorf("Node parents have not been restored")
+	}
+}
+
+func TestASTErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"version":2,"nodes":[]}`, "Unsupported AST version 2"},
+		{`{"nodes":[]}`, "Unsupported AST version 0"},
+		{`{"version":1,"nodes":[{"type":"NodeMagic"}]}`, "Unknown NodeType 'NodeMagic'"},
+		{`{"version":1,"nodes":[{"type":"NodeFunction","token":{"type":"TokenMagic"}}]}`, "Unknown TokenType 'TokenMagic'"},
+		{`{"version":1,"nodes":[null]}`, "Missing node in AST"},
+		{`{"version":1,"nodes":[{"type":"NodeFunction"}]}`, "Missing token for NodeFunction"},
+		{`{"version":1,"nodes":[{"type":"NodeFunction","token":{"type":"TokenIdentifier"},"args":[null]}]}`,
+			"Missing child node for NodeFunction at line 0, pos 0"},
+		{`{"version":1,"nodes":[{"type":"NodeFunction","token":{"type":"TokenIdentifier"},"children":[null]}]}`,
+			"Missing child node for NodeFunction at line 0, pos 0"},
+	}
+	for _, test := range tests {
+		_, err := UnmarshalAST([]byte(test.input))
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Unexpected error for %s: expected [%s], got [%v]", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestParameterFromJSON(t *testing.T) {
+	function := NewFunction("move").AddParameter("distance", UnitLength)
+	data, _ := json.Marshal(function)
+	actual := FunctionDefinition{}
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("JSON unmarshal failed: %v", err)
+	}
+	if param, ok := actual.Parameter("distance"); !ok || param.Units != UnitLength {
+		t.Errorf("Parameter has not been restored: %+v", actual.Parameters)
+	}
+}
+
+func nodesString(nodes []*Node) string {
+	out := make([]string, len(nodes))
+	for pos, node := range nodes {
+		out[pos] = node.String()
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,340 @@
+package robolang
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	invertFunction          = "invert"
+	parallelFunction        = "parallel"
+	repeatUntilFailFunction = "repeatUntilFail"
+	selectorFunction        = "selector"
+	sequenceFunction        = "sequence"
+)
+
+var (
+	// ErrBehaviourFailed is wrapped by the error for a behaviour (e.g. a condition) that has failed. Failures are
+	// handled by the behaviour tree composites, and only fail the script if they reach the top of the tree.
+	ErrBehaviourFailed = errors.New("Behaviour failed")
+)
+
+// BehaviourStatus defines the status of a node the last time it was ticked
+type BehaviourStatus int
+
+//go:generate stringer -type=BehaviourStatus
+
+const (
+	// BehaviourStatusIdle means the node has not been ticked yet
+	BehaviourStatusIdle BehaviourStatus = iota
+
+	// BehaviourStatusRunning means the node has started but not finished yet
+	BehaviourStatusRunning
+
+	// BehaviourStatusSuccess means the node finished successfully
+	BehaviourStatusSuccess
+
+	// BehaviourStatusFailure means the node failed
+	BehaviourStatusFailure
+)
+
+// Name returns the short name of the status (e.g. running)
+func (status BehaviourStatus) Name() string {
+	return strings.ToLower(strings.TrimPrefix(status.String(), "BehaviourStatus"))
+}
+
+// ConditionFunc adapts a Go function to a condition leaf in a behaviour tree: the call fails when it returns false
+type ConditionFunc func(call *Call) (bool, error)
+
+// Start checks the condition
+func (fn ConditionFunc) Start(call *Call) error {
+	ok, err := fn(call)
+	if err == nil && !ok {
+		call.Fail()
+	}
+	return err
+}
+
+// Resume does nothing, as conditions never wait
+func (fn ConditionFunc) Resume(call *Call) error {
+	return nil
+}
+
+// Status returns the status of a node the last time it was ticked.
+func (s *Script) Status(node *Node) BehaviourStatus {
+	return s.statuses[node]
+}
+
+// TreeStatus returns a visualisation of the script with the status of every function, for example:
+//
+//	selector [running]
+//	  isCharged [failure]
+//	  dock [running]
+func (s *Script) TreeStatus() string {
+	var buf strings.Builder
+	var write func(nodes []*Node, indent string)
+	write = func(nodes []*Node, indent string) {
+		for _, node := range nodes {
+			if node.Type != NodeFunction {
+				continue
+			}
+			buf.WriteString(indent + node.Token.Value + " [" + s.Status(node).Name() + "]\n")
+			write(node.Children, indent+"  ")
+		}
+	}
+	write(s.Nodes, "")
+	return buf.String()
+}
+
+func (s *Script) setStatus(node *Node, err error) {
+	if s.statuses == nil {
+		s.statuses = map[*Node]BehaviourStatus{}
+	}
+	if err == nil {
+		s.statuses[node] = BehaviourStatusSuccess
+	} else {
+		s.statuses[node] = BehaviourStatusFailure
+	}
+}
+
+// resetStatus clears the status of some nodes and their children, ready for them to be ticked again.
+func (s *Script) resetStatus(nodes []*Node) {
+	for _, node := range nodes {
+		delete(s.statuses, node)
+		s.resetStatus(node.Children)
+	}
+}
+
+// tick marks a node as running.
+func (s *Script) tick(node *Node) {
+	if s.statuses == nil {
+		s.statuses = map[*Node]BehaviourStatus{}
+	}
+	s.statuses[node] = BehaviourStatusRunning
+}
+
+func newFailure(node *Node, format string, a ...interface{}) error {
+	err := newRuntimeError(node, format, a...)
+	err.Code, err.Err = ErrorCodeFailed, ErrBehaviourFailed
+	return err
+}
+
+func isFailure(err error) bool {
+	return errors.Is(err, ErrBehaviourFailed)
+}
+
+// compositeFrame executes the children of a sequence, selector or decorator one at a time:
+//
+//   - sequence fails as soon as a child fails, and succeeds when they all succeed
+//   - selector succeeds as soon as a child succeeds, and fails when they all fail
+//   - invert runs its children as a sequence and inverts the result
+//   - repeatUntilFail runs its children as a sequence until one fails, then succeeds. It gives up control after each
+//     pass, so the host needs to Poll the script to carry on.
+//
+// Errors are not failures, so they always stop the composite.
+type compositeFrame struct {
+	node    *Node
+	pos     int
+	started bool
+}
+
+func (f *compositeFrame) current() *Node {
+	return f.node
+}
+
+func (f *compositeFrame) step(t *task) {
+	kind, children := f.node.Token.Value, f.node.Children
+	if !f.started {
+		f.started = true
+		t.script.tick(f.node)
+		if kind == repeatUntilFailFunction && len(children) == 0 {
+			f.finish(t, newRuntimeError(f.node, "'%s' needs at least one child", kind))
+			return
+		}
+	} else if result := t.result; result != nil {
+		switch {
+		case !isFailure(result), kind == sequenceFunction:
+			f.finish(t, result)
+			return
+		case kind == invertFunction, kind == repeatUntilFailFunction:
+			f.finish(t, nil)
+			return
+		}
+	} else if kind == selectorFunction {
+		f.finish(t, nil)
+		return
+	}
+
+	if f.pos >= len(children) {
+		switch kind {
+		case selectorFunction:
+			f.finish(t, newFailure(f.node, "All the children of '%s' failed", kind))
+			return
+		case invertFunction:
+			f.finish(t, newFailure(f.node, "'%s' failed as its children succeeded", kind))
+			return
+		case repeatUntilFailFunction:
+			f.pos = 0
+			t.script.resetStatus(children)
+			t.script.yielding = true
+		default:
+			f.finish(t, nil)
+			return
+		}
+	}
+	next, pos := t.script.blockFrame(children, f.pos)
+	f.pos = pos
+	t.push(next)
+}
+
+func (f *compositeFrame) finish(t *task, err error) {
+	t.script.setStatus(f.node, err)
+	t.pop(err)
+}
+
+// joinPolicy defines when a parallel block finishes
+type joinPolicy int
+
+const (
+	// joinThreshold finishes as soon as successThreshold children have succeeded, or that is no longer possible
+	joinThreshold joinPolicy = iota
+
+	// joinAll waits for all the children to finish, and fails with the first failure (if any)
+	joinAll
+
+	// joinAny succeeds as soon as any child succeeds, and fails if they all fail
+	joinAny
+
+	// joinFirstFailure fails as soon as any child fails, and succeeds when they all succeed
+	joinFirstFailure
+)
+
+var joinPolicies = map[string]joinPolicy{
+	"all":          joinAll,
+	"any":          joinAny,
+	"firstFailure": joinFirstFailure,
+}
+
+// parallelFrame executes all the children of a parallel node at the same time, each in its own task. The join
+// argument sets when the block finishes (all, any or firstFailure), otherwise it succeeds as soon as successThreshold
+// children have succeeded (by default all of them), and fails as soon as that is no longer possible. Any children
+// that are still running when the block finishes are cancelled.
+type parallelFrame struct {
+	err       error
+	failed    int
+	failure   error
+	node      *Node
+	owner     *task
+	policy    joinPolicy
+	succeeded int
+	tasks     []*task
+	threshold int
+}
+
+func (f *parallelFrame) current() *Node {
+	return f.node
+}
+
+func (f *parallelFrame) step(t *task) {
+	if f.owner == nil {
+		f.owner = t
+		t.script.tick(f.node)
+		if err := f.start(t); err != nil {
+			f.finish(t, err)
+		} else if len(f.tasks) == 0 {
+			f.finish(t, nil)
+		}
+		return
+	}
+
+	f.cancel(t)
+	switch {
+	case f.err != nil:
+		f.finish(t, f.err)
+	case f.failure != nil && (f.policy == joinAll || f.policy == joinFirstFailure):
+		f.finish(t, f.failure)
+	case f.succeeded >= f.threshold:
+		f.finish(t, nil)
+	default:
+		f.finish(t, newFailure(f.node, "Only %d of the children of '%s' succeeded, %d needed", f.succeeded, f.node.Token.Value, f.threshold))
+	}
+}
+
+func (f *parallelFrame) start(t *task) error {
+	children := f.node.Children
+	f.threshold = len(children)
+	call := newCall(t.script, f.node)
+	if call.Arg("successThreshold") != nil {
+		value, err := call.Value("successThreshold")
+		if err != nil {
+			return wrapRuntimeError(f.node, err)
+		}
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 1 || threshold > len(children) {
+			return newRuntimeError(f.node, "successThreshold must be a whole number between 1 and %d, found '%s'", len(children), value)
+		}
+		f.threshold = threshold
+	}
+	if arg := call.Arg("join"); arg != nil {
+		policy, ok := joinPolicies[arg.Token.Value]
+		switch {
+		case arg.Type != NodeConstant || !ok:
+			return newRuntimeError(arg, "join must be 'all', 'any' or 'firstFailure', found '%s'", arg.Token.Value)
+		case call.Arg("successThreshold") != nil:
+			return newRuntimeError(arg, "join and successThreshold cannot be used together")
+		case policy == joinAny && len(children) > 0:
+			f.threshold = 1
+		}
+		f.policy = policy
+	}
+
+	for _, child := range children {
+		sub := t.script.startTask(t.script.newFrame(child), t.priority)
+		sub.handler, sub.onDone, sub.parent = t.handler, f.childDone, t
+		f.tasks = append(f.tasks, sub)
+	}
+	t.blocked = len(f.tasks) > 0
+	return nil
+}
+
+func (f *parallelFrame) childDone(sub *task) {
+	if sub.cancelled {
+		return
+	}
+	switch {
+	case sub.result == nil:
+		f.succeeded++
+	case isFailure(sub.result):
+		f.failed++
+		if f.failure == nil {
+			f.failure = sub.result
+		}
+	case f.err == nil:
+		f.err = sub.result
+	}
+
+	finished := f.err != nil || f.succeeded+f.failed == len(f.tasks)
+	if f.policy != joinAll {
+		finished = finished || f.succeeded >= f.threshold || f.failed > len(f.tasks)-f.threshold
+	}
+	if finished {
+		f.owner.blocked = false
+	}
+}
+
+// cancel stops any children that are still running.
+func (f *parallelFrame) cancel(t *task) bool {
+	for _, sub := range f.tasks {
+		if !sub.done {
+			t.script.cancelTask(sub)
+		}
+	}
+	t.blocked = false
+	return false
+}
+
+func (f *parallelFrame) finish(t *task, err error) {
+	t.script.setStatus(f.node, err)
+	t.pop(err)
+}
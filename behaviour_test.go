@@ -0,0 +1,177 @@
+package robolang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBehaviourComposites(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"sequence():\n  say(text='a')\n  say(text='b')", "a,b", ""},
+		{"sequence():\n  say(text='a')\n  isTrue(value='no')\n  say(text='b')", "a", "'isTrue' failed at line 2, pos 2"},
+		{"selector():\n  isTrue(value='no')\n  say(text='a')\n  say(text='b')", "a", ""},
+		{"selector():\n  isTrue(value='no')\n  isTrue(value='no')", "", "All the children of 'selector' failed at line 0, pos 0"},
+		{"invert():\n  isTrue(value='no')\nsay(text='a')", "a", ""},
+		{"invert():\n  say(text='a')", "a", "'invert' failed as its children succeeded at line 0, pos 0"},
+		{"selector():\n  sequence():\n    say(text='a')\n    isTrue(value='no')\n  say(text='b')", "a,b", ""},
+		{"selector():\n  unknown()\n  say(text='b')", "", "Unknown function 'unknown' at line 1, pos 2"},
+		{"repeatUntilFail()", "", "'repeatUntilFail' needs at least one child at line 0, pos 0"},
+	}
+	for _, test := range tests {
+		var log []string
+		script := newBehaviourScript(t, test.input, &log)
+		err := script.Start()
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("Unexpected error for `%s`: expected [%s], got [%v]", test.input, test.err, err)
+		}
+		if actual := strings.Join(log, ","); actual != test.expected {
+			t.Errorf("Unexpected log for `%s`: expected [%s], got [%s]", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestBehaviourRepeatUntilFail(t *testing.T) {
+	var log []string
+	script := newBehaviourScript(t, "repeatUntilFail():\n  countDown()\n  say(text='tick')\nsay(text='done')", &log)
+	script.Variables = NewVariableTable()
+	script.setVariable("count", "3")
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Control goes back to the host after each pass
+	checkLog(t, log, "tick")
+	if script.State != ScriptStatePaused {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStatePaused.String(), script.State.String())
+	}
+	for script.State == ScriptStatePaused {
+		if err := script.Poll(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	checkLog(t, log, "tick,tick,tick,done")
+}
+
+func TestBehaviourRepeatForever(t *testing.T) {
+	var log []string
+	script := newBehaviourScript(t, "repeatUntilFail():\n  say(text='tick')", &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := script.Poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "tick,tick")
+	if err := script.Cancel(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if script.State != ScriptStateCancelled {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateCancelled.String(), script.State.String())
+	}
+}
+
+func TestBehaviourRepeatWhileWaiting(t *testing.T) {
+	var log []string
+	input := "on(event='bump', mode='interrupt'):\n  say(text='bump')\n" +
+		"parallel():\n  waitForInput()\n  repeatUntilFail():\n    isTrue(value='yes')"
+	script := newBehaviourScript(t, input, &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Events and input can be passed to a script that gave up control part way through a loop
+	if err := script.Raise("bump"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := script.Resume("x"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,bump,input:x")
+	if script.State != ScriptStatePaused {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStatePaused.String(), script.State.String())
+	}
+}
+
+func TestBehaviourParallel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"parallel():\n  say(text='a')\n  say(text='b')", "a,b", ""},
+		{"parallel():\n  say(text='a')\n  isTrue(value='no')\n  waitForInput()", "a,wait", "Only 1 of the children of 'parallel' succeeded, 3 needed at line 0, pos 0"},
+		{"parallel(successThreshold=1):\n  waitForInput()\n  say(text='a')\nsay(text='b')", "wait,a,b", ""},
+		{"parallel(successThreshold=2):\n  isTrue(value='no')\n  say(text='a')\n  say(text='b')", "a,b", ""},
+		{"parallel(successThreshold=4):\n  say(text='a')", "", "successThreshold must be a whole number between 1 and 1, found '4' at line 0, pos 0"},
+		{"parallel():\n  waitForInput()\n  unknown()", "wait", "Unknown function 'unknown' at line 2, pos 2"},
+		{"parallel()\nsay(text='a')", "a", ""},
+	}
+	for _, test := range tests {
+		var log []string
+		script := newBehaviourScript(t, test.input, &log)
+		err := script.Start()
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("Unexpected error for `%s`: expected [%s], got [%v]", test.input, test.err, err)
+		}
+		if actual := strings.Join(log, ","); actual != test.expected {
+			t.Errorf("Unexpected log for `%s`: expected [%s], got [%s]", test.input, test.expected, actual)
+		}
+		if err == nil && script.State != ScriptStateFinished {
+			t.Errorf("Unexpected script state for `%s`: expected %s, actual %s", test.input, ScriptStateFinished.String(), script.State.String())
+		}
+	}
+}
+
+func TestBehaviourParallelWaiting(t *testing.T) {
+	var log []string
+	script := newBehaviourScript(t, "parallel():\n  waitForInput()\n  waitForInput()\nsay(text='done')", &log)
+	script.Start()
+	checkLog(t, log, "wait,wait")
+	// Each input goes to one of the waiting calls
+	if err := script.Resume("go"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,wait,input:go")
+	if err := script.Resume("again"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,wait,input:go,input:again,done")
+}
+
+func TestBehaviourTreeStatus(t *testing.T) {
+	var log []string
+	script := newBehaviourScript(t, "selector():\n  isTrue(value='no')\n  waitForInput()\n  say(text='a')", &log)
+	script.Start()
+	expected := "selector [running]\n  isTrue [failure]\n  waitForInput [running]\n  say [idle]\n"
+	if actual := script.TreeStatus(); actual != expected {
+		t.Errorf("Unexpected tree status: expected\n%s\ngot\n%s", expected, actual)
+	}
+
+	script.Resume("")
+	expected = "selector [success]\n  isTrue [failure]\n  waitForInput [success]\n  say [idle]\n"
+	if actual := script.TreeStatus(); actual != expected {
+		t.Errorf("Unexpected tree status: expected\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func newBehaviourScript(t *testing.T, input string, log *[]string) *Script {
+	script := newTestScript(t, input, log)
+	script.Functions.Functions["isTrue"] = NewFunction("isTrue").SetFunction(ConditionFunc(func(call *Call) (bool, error) {
+		value, err := call.Value("value")
+		return value == "yes", err
+	}))
+	script.Functions.Functions["countDown"] = NewFunction("countDown").SetFunction(ConditionFunc(func(call *Call) (bool, error) {
+		variable, _ := call.Script.Variables.Get("count")
+		count := *variable.Value
+		if count == "0" {
+			return false, nil
+		}
+		variable.Set(string(count[0] - 1))
+		return true, nil
+	}))
+	return script
+}
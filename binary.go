@@ -0,0 +1,320 @@
+package robolang
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// BinaryVersion is the current version of the binary format produced by EncodeBinary
+const BinaryVersion = 1
+
+var (
+	binaryMagic = []byte("RBLA")
+
+	// ErrCorruptBinary is returned when binary data cannot be decoded
+	ErrCorruptBinary = errors.New("Corrupt binary AST")
+)
+
+const (
+	binaryFlagDebug byte = 1 << iota
+)
+
+const (
+	binaryNodeToken byte = 1 << iota
+	binaryNodeQuantity
+)
+
+const (
+	maxBinaryDepth = 256
+)
+
+// EncodeBinary converts a list of nodes to a compact binary format for sending to constrained devices.
+//
+// The format starts with a header (magic, version and flags), followed by a table of interned strings, the nodes
+// and, when debugInfo is set, a section with the source locations, file names and doc comments of every node.
+func EncodeBinary(nodes []*Node, debugInfo bool) []byte {
+	e := &binaryEncoder{strings: map[string]uint64{}}
+	var flags byte
+	if debugInfo {
+		flags |= binaryFlagDebug
+	}
+
+	var body bytes.Buffer
+	e.writeNodes(&body, nodes)
+	if debugInfo {
+		e.walk(nodes, func(node *Node) {
+			e.writeDebug(&body, node)
+		})
+	}
+
+	var out bytes.Buffer
+	out.Write(binaryMagic)
+	out.WriteByte(BinaryVersion)
+	out.WriteByte(flags)
+	writeUvarint(&out, uint64(len(e.table)))
+	for _, value := range e.table {
+		writeUvarint(&out, uint64(len(value)))
+		out.WriteString(value)
+	}
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+// DecodeBinary converts data produced by EncodeBinary back into a list of nodes.
+func DecodeBinary(data []byte) ([]*Node, error) {
+	d := &binaryDecoder{data: data}
+	if !bytes.HasPrefix(data, binaryMagic) {
+		return nil, fmt.Errorf("%w: missing header", ErrCorruptBinary)
+	}
+	d.pos = len(binaryMagic)
+	if version := d.readByte(); version != BinaryVersion {
+		if d.err != nil {
+			return nil, d.err
+		}
+		return nil, fmt.Errorf("Unsupported binary AST version %d", version)
+	}
+	flags := d.readByte()
+
+	count := d.readCount()
+	for ; count > 0 && d.err == nil; count-- {
+		d.table = append(d.table, string(d.readBytes(d.readCount())))
+	}
+
+	nodes := d.readNodes(nil, 0)
+	if flags&binaryFlagDebug != 0 {
+		d.walk(nodes, d.readDebug)
+	}
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("unexpected data after nodes")
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return nodes, nil
+}
+
+type binaryEncoder struct {
+	strings map[string]uint64
+	table   []string
+}
+
+func (e *binaryEncoder) intern(value string) uint64 {
+	index, ok := e.strings[value]
+	if !ok {
+		index = uint64(len(e.table))
+		e.strings[value] = index
+		e.table = append(e.table, value)
+	}
+	return index
+}
+
+func (e *binaryEncoder) walk(nodes []*Node, action func(*Node)) {
+	for _, node := range nodes {
+		action(node)
+		e.walk(node.Args, action)
+		e.walk(node.Children, action)
+	}
+}
+
+func (e *binaryEncoder) writeDebug(buf *bytes.Buffer, node *Node) {
+	writeUvarint(buf, e.intern(node.Doc))
+	writeUvarint(buf, uint64(node.Start.LineNum))
+	writeUvarint(buf, uint64(node.Start.LinePos))
+	writeUvarint(buf, uint64(node.End.LineNum))
+	writeUvarint(buf, uint64(node.End.LinePos))
+	if node.Token != nil {
+		writeUvarint(buf, e.intern(node.Token.File))
+		writeUvarint(buf, uint64(node.Token.LineNum))
+		writeUvarint(buf, uint64(node.Token.LinePos))
+	}
+}
+
+func (e *binaryEncoder) writeNodes(buf *bytes.Buffer, nodes []*Node) {
+	writeUvarint(buf, uint64(len(nodes)))
+	for _, node := range nodes {
+		var flags byte
+		if node.Token != nil {
+			flags |= binaryNodeToken
+		}
+		if node.Quantity != nil {
+			flags |= binaryNodeQuantity
+		}
+		buf.WriteByte(flags)
+		buf.WriteByte(byte(node.Type))
+		if node.Token != nil {
+			buf.WriteByte(byte(node.Token.Type))
+			writeUvarint(buf, e.intern(node.Token.Value))
+		}
+		if node.Quantity != nil {
+			buf.WriteByte(byte(node.Quantity.Family))
+			var value [8]byte
+			binary.LittleEndian.PutUint64(value[:], math.Float64bits(node.Quantity.Value))
+			buf.Write(value[:])
+		}
+		e.writeNodes(buf, node.Args)
+		e.writeNodes(buf, node.Children)
+	}
+}
+
+type binaryDecoder struct {
+	data  []byte
+	err   error
+	pos   int
+	table []string
+}
+
+func (d *binaryDecoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s at offset %d", ErrCorruptBinary, fmt.Sprintf(format, a...), d.pos)
+	}
+}
+
+func (d *binaryDecoder) readByte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.data) {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	d.pos++
+	return d.data[d.pos-1]
+}
+
+func (d *binaryDecoder) readBytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data)-d.pos {
+		d.fail("unexpected end of data")
+		return nil
+	}
+	d.pos += n
+	return d.data[d.pos-n : d.pos]
+}
+
+// readCount reads a length or count. Every counted item takes at least one byte, so anything larger than the
+// remaining data must be corrupt (this also stops huge allocations).
+func (d *binaryDecoder) readCount() int {
+	value := d.readUvarint()
+	if d.err == nil && value > uint64(len(d.data)-d.pos) {
+		d.fail("count %d is too large", value)
+		return 0
+	}
+	return int(value)
+}
+
+func (d *binaryDecoder) readInt() int {
+	value := d.readUvarint()
+	if value > math.MaxInt32 {
+		d.fail("value %d is too large", value)
+		return 0
+	}
+	return int(value)
+}
+
+func (d *binaryDecoder) readString() string {
+	index := d.readUvarint()
+	if d.err != nil {
+		return ""
+	}
+	if index >= uint64(len(d.table)) {
+		d.fail("invalid string index %d", index)
+		return ""
+	}
+	return d.table[index]
+}
+
+func (d *binaryDecoder) readUvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+	d.pos += n
+	return value
+}
+
+func (d *binaryDecoder) readDebug(node *Node) {
+	node.Doc = d.readString()
+	node.Start.LineNum, node.Start.LinePos = d.readInt(), d.readInt()
+	node.End.LineNum, node.End.LinePos = d.readInt(), d.readInt()
+	if node.Token != nil {
+		node.Token.File = d.readString()
+		node.Token.LineNum, node.Token.LinePos = d.readInt(), d.readInt()
+	}
+}
+
+func (d *binaryDecoder) readNodes(parent *Node, depth int) []*Node {
+	if depth > maxBinaryDepth {
+		d.fail("nodes are nested too deeply")
+		return nil
+	}
+
+	count := d.readCount()
+	var nodes []*Node
+	for ; count > 0 && d.err == nil; count-- {
+		flags := d.readByte()
+		nodeType := NodeType(d.readByte())
+		if nodeType.String() == fmt.Sprintf("NodeType(%d)", nodeType) {
+			d.fail("invalid node type %d", nodeType)
+			break
+		}
+		node := &Node{
+			Parent:   parent,
+			Type:     nodeType,
+			TypeText: nodeType.String(),
+		}
+
+		if flags&binaryNodeToken != 0 {
+			tokenType := TokenType(d.readByte())
+			if tokenType.String() == fmt.Sprintf("TokenType(%d)", tokenType) {
+				d.fail("invalid token type %d", tokenType)
+				break
+			}
+			node.Token = &Token{
+				Type:     tokenType,
+				TypeName: tokenType.String(),
+				Value:    d.readString(),
+			}
+			node.last = node.Token
+		}
+		if flags&binaryNodeQuantity != 0 {
+			family := UnitFamily(d.readByte())
+			if family.String() == fmt.Sprintf("UnitFamily(%d)", family) {
+				d.fail("invalid unit family %d", family)
+				break
+			}
+			value := d.readBytes(8)
+			if d.err != nil {
+				break
+			}
+			node.Quantity = NewQuantity(math.Float64frombits(binary.LittleEndian.Uint64(value)), family)
+		}
+
+		node.Args = d.readNodes(node, depth+1)
+		node.Children = d.readNodes(node, depth+1)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (d *binaryDecoder) walk(nodes []*Node, action func(*Node)) {
+	for _, node := range nodes {
+		action(node)
+		d.walk(node.Args, action)
+		d.walk(node.Children, action)
+	}
+}
+
+func writeUvarint(buf *bytes.Buffer, value uint64) {
+	var data [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(data[:], value)
+	buf.Write(data[:n])
+}
@@ -0,0 +1,93 @@
+package robolang
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+const binaryTestScript = "## Greets a visitor\nwaitForInput():\n  move(distance=30cm, speed=5kph)\n  say(text='Hello {&name}')\n  say(text='Hello {&name}')\n  show(resource=@smile)"
+
+func TestBinaryRoundTrip(t *testing.T) {
+	result := NewParser(binaryTestScript).Parse()
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors while parsing: [%v]", result.Errors)
+	}
+
+	for _, debugInfo := range []bool{false, true} {
+		data := EncodeBinary(result.Nodes, debugInfo)
+		nodes, err := DecodeBinary(data)
+		if err != nil {
+			t.Errorf("Unable to decode (debug %v): %v", debugInfo, err)
+			continue
+		}
+		if expected, actual := nodesString(result.Nodes), nodesString(nodes); expected != actual {
+			t.Errorf("Binary does not round trip (debug %v): expected [%s], got [%s]", debugInfo, expected, actual)
+		}
+		if debugInfo {
+			expected, _ := MarshalAST(result.Nodes)
+			actual, _ := MarshalAST(nodes)
+			if string(expected) != string(actual) {
+				t.Errorf("Debug info does not round trip: expected %s, got %s", expected, actual)
+			}
+		}
+	}
+}
+
+func TestBinaryIsCompact(t *testing.T) {
+	result := NewParser(binaryTestScript).Parse()
+	json, _ := MarshalAST(result.Nodes)
+	data := EncodeBinary(result.Nodes, false)
+	if len(data)*5 > len(json) {
+		t.Errorf("Binary is not compact: %d bytes, JSON is %d bytes", len(data), len(json))
+	}
+}
+
+func TestBinaryErrors(t *testing.T) {
+	valid := EncodeBinary(NewParser("clear()").Parse().Nodes, false)
+	tests := []struct {
+		input    []byte
+		expected string
+	}{
+		{[]byte("JUNK"), "Corrupt binary AST: missing header"},
+		{[]byte("RBLA"), "Corrupt binary AST: unexpected end of data at offset 4"},
+		{[]byte("RBLA\x09\x00"), "Unsupported binary AST version 9"},
+		{[]byte("RBLA\x01\x00\xff\xff\xff\x0f"), "Corrupt binary AST: count 33554431 is too large at offset 10"},
+		{[]byte("RBLA\x01\x00\x00\x01\x00\x63"), "Corrupt binary AST: invalid node type 99 at offset 10"},
+		{append(append([]byte{}, valid...), 0), "Corrupt binary AST: unexpected data after nodes at offset " + strconv.Itoa(len(valid))},
+	}
+	for _, test := range tests {
+		_, err := DecodeBinary(test.input)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Unexpected error for %q: expected [%s], got [%v]", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestBinaryCorruptInput(t *testing.T) {
+	data := EncodeBinary(NewParser(binaryTestScript).Parse().Nodes, true)
+	for size := 0; size < len(data); size++ {
+		if _, err := DecodeBinary(data[:size]); err == nil {
+			t.Errorf("Expected an error decoding the first %d bytes, not nil", size)
+		}
+	}
+	for pos := range data {
+		for _, value := range []byte{0x00, 0x7f, 0x80, 0xff} {
+			corrupt := append([]byte{}, data...)
+			corrupt[pos] = value
+			if _, err := DecodeBinary(corrupt); err != nil && !errors.Is(err, ErrCorruptBinary) && pos != 4 {
+				t.Errorf("Unexpected error type for byte %d = %x: %v", pos, value, err)
+			}
+		}
+	}
+}
+
+func TestBinaryNesting(t *testing.T) {
+	data := []byte("RBLA\x01\x00\x00\x01")
+	for depth := 0; depth < 10000; depth++ {
+		data = append(data, 0, byte(NodeFunction), 1)
+	}
+	if _, err := DecodeBinary(data); !errors.Is(err, ErrCorruptBinary) {
+		t.Errorf("Expected a corrupt binary error, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package robolang
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrorCodeBudget means the script ran for too long without waiting
+const ErrorCodeBudget = "budget"
+
+var (
+	// ErrInstructionBudgetExceeded is wrapped by the error when a run executes more instructions than its budget
+	ErrInstructionBudgetExceeded = errors.New("Instruction budget exceeded")
+
+	// ErrTimeBudgetExceeded is wrapped by the error when a run takes longer than its budget
+	ErrTimeBudgetExceeded = errors.New("Time budget exceeded")
+)
+
+// Budget limits how much work a script can do in a single run, so a runaway loop stops with an error instead of
+// hanging the robot. A run is a single call to Start, Resume, Raise or Poll, so time spent waiting (e.g. for input)
+// does not count. A run that is paused (e.g. by a scheduler) carries on when it continues, but the time spent paused
+// does not count either. Zero means no limit.
+type Budget struct {
+	// Instructions is the maximum number of steps (node boundaries) in a run
+	Instructions int
+
+	// Time is the maximum wall-clock time of a run, measured by the script's clock
+	Time time.Duration
+}
+
+// StartContext begins executing the script, stopping it if the context is cancelled or its deadline passes. The
+// context is checked at every node boundary for the lifetime of the script (including later calls to Resume, Raise
+// and Poll), and is available to functions through Call.Context so they can stop waiting.
+//
+// Stopping works like Cancel, so any active finally blocks run first, but the script then fails with the context's
+// error. The finally blocks cannot wait for anything though: as soon as they would, the script is stopped straight
+// away. A script that is waiting does not notice the context has been cancelled until the next call to Poll, Resume
+// or Raise (an Execution does this straight away).
+func (s *Script) StartContext(ctx context.Context) error {
+	if s.State != ScriptStatePending {
+		return ErrScriptNotRunning
+	}
+	s.ctx = ctx
+	return s.Start()
+}
+
+// Context returns the context the script is running in, so functions that wait can stop when it is cancelled
+func (c *Call) Context() context.Context {
+	return c.Script.context()
+}
+
+func (s *Script) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// checkBudget makes sure a task can take another step within the script's context and budget.
+func (s *Script) checkBudget(t *task) error {
+	if s.stopped == nil {
+		if err := s.contextError(t); err != nil {
+			s.stop(err)
+		}
+	}
+
+	node := t.frames[len(t.frames)-1].current()
+	s.usage.steps++
+	if limit := s.Budget.Instructions; limit > 0 && s.usage.steps > limit {
+		rt := newRuntimeError(node, "Instruction budget of %d exceeded", limit)
+		rt.Code, rt.Err = ErrorCodeBudget, ErrInstructionBudgetExceeded
+		return rt
+	}
+	if limit := s.Budget.Time; limit > 0 && s.now().Sub(s.usage.started) > limit {
+		rt := newRuntimeError(node, "Time budget of %s exceeded", FormatDuration(limit))
+		rt.Code, rt.Err = ErrorCodeBudget, ErrTimeBudgetExceeded
+		return rt
+	}
+	return nil
+}
+
+// contextError checks whether the script's context has been cancelled (or its deadline has passed).
+func (s *Script) contextError(t *task) error {
+	err := s.context().Err()
+	if err == nil {
+		return nil
+	}
+	rt := newRuntimeError(t.frames[len(t.frames)-1].current(), "Script stopped: %v", err)
+	rt.Code, rt.Err = ErrorCodeCancelled, err
+	return rt
+}
+
+// stop cancels the script when its context has been cancelled. Like Cancel any finally blocks run first (unless the
+// script has already been cancelled), and then the script fails with err.
+func (s *Script) stop(err error) {
+	s.stopped = err
+	if s.cancelled {
+		return
+	}
+	s.cancelled, s.queued = true, nil
+	for _, t := range s.tasks {
+		s.cancelTask(t)
+	}
+}
+
+// abort stops the script straight away, without running any finally blocks. Any functions that are waiting are
+// cancelled.
+func (s *Script) abort(err error) {
+	for _, t := range s.tasks {
+		for pos := len(t.frames) - 1; pos >= 0; pos-- {
+			if f, ok := t.frames[pos].(*callFrame); ok {
+				f.cancel(t)
+			}
+		}
+		if s.Locks != nil {
+			s.Locks.releaseAll(t)
+		}
+	}
+	s.err, s.tasks, s.timers = err, nil, nil
+}
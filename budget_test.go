@@ -0,0 +1,146 @@
+package robolang
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInstructionBudget(t *testing.T) {
+	var log []string
+	script := newBehaviourScript(t, "try():\n  repeatUntilFail():\n    isTrue(value='yes')\ncatch():\n  say(text='caught')", &log)
+	script.Budget.Instructions = 1000
+	// The budget covers all the passes of the loop, even though it gives up control after each one
+	err := script.Start()
+	for err == nil && script.State == ScriptStatePaused {
+		err = script.Poll()
+	}
+	if !errors.Is(err, ErrInstructionBudgetExceeded) {
+		t.Fatalf("Unexpected error: expected %v, got %v", ErrInstructionBudgetExceeded, err)
+	}
+	if err.Error() != "Instruction budget of 1000 exceeded at line 2, pos 4" {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+	if script.State != ScriptStateFailed {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFailed.String(), script.State.String())
+	}
+	checkLog(t, log, "")
+}
+
+func TestInstructionBudgetWithEvents(t *testing.T) {
+	var log []string
+	script := newBehaviourScript(t, "repeatUntilFail():\n  isTrue(value='yes')", &log)
+	script.Budget.Instructions = 100
+	err := script.Start()
+
+	// Raising events does not start a new run, so the loop still uses up its budget
+	for count := 0; err == nil && count < 1000; count++ {
+		err = script.Raise("bump")
+	}
+	if !errors.Is(err, ErrInstructionBudgetExceeded) {
+		t.Errorf("Unexpected error: expected %v, got %v", ErrInstructionBudgetExceeded, err)
+	}
+}
+
+func TestInstructionBudgetPerRun(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "say(text='a')\nwaitForInput()\nsay(text='b')\nwaitForInput()\nsay(text='c')", &log)
+	script.Budget.Instructions = 6
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := script.Resume(""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := script.Resume(""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "a,wait,input:,b,wait,input:,c")
+}
+
+func TestTimeBudget(t *testing.T) {
+	var log []string
+	script := newBehaviourScript(t, "repeatUntilFail():\n  isTrue(value='yes')", &log)
+	script.Clock = &steppingClock{ManualClock: NewManualClock(time.Now()), step: time.Millisecond}
+	script.Budget.Time = time.Second
+	err := script.Start()
+	for err == nil && script.State == ScriptStatePaused {
+		err = script.Poll()
+	}
+	if !errors.Is(err, ErrTimeBudgetExceeded) || err.Error() != "Time budget of 1s exceeded at line 1, pos 2" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestContextCancelled(t *testing.T) {
+	var log []string
+	ctx, cancel := context.WithCancel(context.Background())
+	script := newTestScript(t, "try():\n  waitForInput()\nfinally():\n  say(text='finally')", &log)
+	script.Functions.Functions["waitForInput"].Function = &cancellableWait{waitForInput{log: &log}}
+	if err := script.StartContext(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cancel()
+	err := script.Poll()
+	if !errors.Is(err, context.Canceled) || err.Error() != "Script stopped: context canceled at line 1, pos 2" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,cancelled,finally")
+	if script.State != ScriptStateFailed {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFailed.String(), script.State.String())
+	}
+}
+
+func TestContextCancelledFinallyWaits(t *testing.T) {
+	var log []string
+	ctx, cancel := context.WithCancel(context.Background())
+	script := newTestScript(t, "try():\n  waitForInput()\nfinally():\n  waitForInput()\n  say(text='finally')", &log)
+	script.Functions.Functions["waitForInput"].Function = &cancellableWait{waitForInput{log: &log}}
+	if err := script.StartContext(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The finally block is stopped as soon as it waits
+	cancel()
+	if err := script.Poll(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,cancelled,wait,cancelled")
+	if script.State != ScriptStateFailed {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFailed.String(), script.State.String())
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	var log []string
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	script := newTestScript(t, "say(text='a')", &log)
+	err := script.StartContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "")
+
+	script = newTestScript(t, "waitForInput()", &log)
+	script.StartContext(context.Background())
+	var call *Call
+	for _, task := range script.tasks {
+		call = task.waitingCall()
+	}
+	if call == nil || call.Context() != context.Background() {
+		t.Errorf("Expected waiting functions to have the script's context")
+	}
+}
+
+// steppingClock moves forward every time it is read, like a real clock while a script is running.
+type steppingClock struct {
+	*ManualClock
+	step time.Duration
+}
+
+func (clock *steppingClock) Now() time.Time {
+	clock.Advance(clock.step)
+	return clock.ManualClock.Now()
+}
@@ -0,0 +1,137 @@
+package robolang
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Call is a single execution of a function in a script
+type Call struct {
+	Event  *Event
+	Input  string
+	Node   *Node
+	Script *Script
+
+	failed   bool
+	function Function
+	resumed  bool
+	waiting  bool
+}
+
+func newCall(s *Script, node *Node) *Call {
+	return &Call{
+		Node:   node,
+		Script: s,
+	}
+}
+
+// Arg returns the value node for an argument, or nil if the argument was not passed
+func (c *Call) Arg(name string) *Node {
+	for _, arg := range c.Node.Args {
+		if arg.Token.Value == name && len(arg.Children) > 0 {
+			return arg.Children[0]
+		}
+	}
+	return nil
+}
+
+// Value returns the value of an argument. Variables are replaced with their current value, and any interpolations in
+// text are rendered.
+func (c *Call) Value(name string) (string, error) {
+	arg := c.Arg(name)
+	if arg == nil {
+		return "", fmt.Errorf("Missing argument '%s'", name)
+	}
+
+	switch arg.Type {
+	case NodeTemplate:
+		return arg.Render(c.Script.Variables)
+	case NodeVariable:
+		value, ok := c.Script.Variables.Value(arg.Token.Value)
+		if !ok {
+			return "", fmt.Errorf("Unknown variable '%s'", arg.Token.Value)
+		}
+		return value, nil
+	}
+	return arg.Token.Value, nil
+}
+
+// Duration returns the value of an argument as a duration. Numbers without any units are in seconds.
+func (c *Call) Duration(name string) (time.Duration, error) {
+	value, err := c.Value(name)
+	if err != nil {
+		return 0, err
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	quantity, err := Units.Parse(value)
+	if err != nil || quantity.Family != UnitTime {
+		return 0, fmt.Errorf("Argument '%s' must be a duration, found '%s'", name, value)
+	}
+	return time.Duration(quantity.Value * float64(time.Second)), nil
+}
+
+// Quantity returns the value of an argument as a quantity in the canonical units for its family (e.g. 30cm is 0.3
+// metres). Numbers without any units have no family.
+func (c *Call) Quantity(name string) (*Quantity, error) {
+	if arg := c.Arg(name); arg != nil && arg.Quantity != nil {
+		return NewQuantity(arg.Quantity.Value, arg.Quantity.Family), nil
+	}
+	value, err := c.Value(name)
+	if err != nil {
+		return nil, err
+	}
+	quantity, err := Units.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("Argument '%s' must be a quantity, found '%s'", name, value)
+	}
+	return quantity, nil
+}
+
+// ValueOr returns the value of an argument, or a default if the argument was not passed
+func (c *Call) ValueOr(name, value string) (string, error) {
+	if c.Arg(name) == nil {
+		return value, nil
+	}
+	return c.Value(name)
+}
+
+// Set sets the value of the variable that an argument points to (e.g. into=&name)
+func (c *Call) Set(name, value string) error {
+	arg := c.Arg(name)
+	if arg == nil || arg.Type != NodeVariable {
+		return fmt.Errorf("Argument '%s' must be a variable", name)
+	}
+	c.Script.setVariable(arg.Token.Value, value)
+	return nil
+}
+
+// Fail marks the call as failed without it being an error, for example a condition in a behaviour tree that is false
+func (c *Call) Fail() {
+	c.failed = true
+}
+
+// Resumed checks whether the call has been resumed since it last waited
+func (c *Call) Resumed() bool {
+	return c.resumed
+}
+
+// Wait suspends the call until the script is resumed
+func (c *Call) Wait() {
+	c.waiting = true
+}
+
+func (c *Call) resume() {
+	c.waiting, c.resumed = false, true
+}
+
+// setVariable sets a variable, adding it if it does not already exist.
+func (s *Script) setVariable(name, value string) *VariableDefinition {
+	variable, ok := s.Variables.Get(name)
+	if !ok {
+		variable, _ = s.Variables.Add(name)
+	}
+	return variable.Set(value)
+}
@@ -0,0 +1,357 @@
+package robolang
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	emitFunction    = "emit"
+	receiveFunction = "receive"
+)
+
+// DefaultChannelCapacity is the number of messages a channel buffers when it is created without a capacity
+const DefaultChannelCapacity = 16
+
+var (
+	// ErrMessageTimeout is wrapped by the error when a message cannot be sent or received in time
+	ErrMessageTimeout = errors.New("Timed out waiting for a message")
+)
+
+// ChannelMode defines who receives the messages sent on a channel
+type ChannelMode int
+
+//go:generate stringer -type=ChannelMode
+
+const (
+	// ChannelModeQueue delivers each message to a single receiver, in the order they were sent. Senders wait while
+	// the buffer is full.
+	ChannelModeQueue ChannelMode = iota
+
+	// ChannelModeBroadcast delivers every message to every script that receives from the channel. Senders never
+	// wait: when the buffer is full the oldest message is discarded. The buffer is also replayed to scripts that
+	// start receiving later, so a new receiver first gets the messages sent before it started (up to the capacity).
+	ChannelModeBroadcast
+)
+
+// Channels is a set of named channels that scripts use to send messages to each other, for example:
+//
+//	emit(channel='visitor', value='{&name}')
+//
+//	receive(channel='visitor', into=&visitor, timeout=30s):
+//	  say(text='Hello {&visitor}')
+//
+// Scripts that share the same Channels can talk to each other, and a Channels can be shared by scripts running on
+// different goroutines. Channels that have not been added are created as queues the first time they are used.
+//
+// Scripts run by a Scheduler or with Run carry on as soon as a message arrives (or there is room to send one), other
+// scripts carry on the next time they are polled.
+type Channels struct {
+	channels map[string]*Channel
+	lock     sync.Mutex
+}
+
+// Channel is a named channel between scripts
+type Channel struct {
+	Capacity int
+	Mode     ChannelMode
+	Name     string
+
+	cursors   map[*Script]int
+	first     int
+	messages  []string
+	receivers map[*Script]bool
+	watchers  []func()
+}
+
+// NewChannels creates a new set of channels
+func NewChannels() *Channels {
+	return &Channels{channels: map[string]*Channel{}}
+}
+
+// Add creates a new channel with a mode and the number of messages it can buffer (zero means the default).
+func (c *Channels) Add(name string, mode ChannelMode, capacity int) (*Channel, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, exists := c.channels[name]; exists {
+		return nil, fmt.Errorf("Channel %s already exists", name)
+	}
+	return c.add(name, mode, capacity), nil
+}
+
+// Pending returns the messages on each channel that a script has not received yet. The messages on a queue are shared
+// by all the scripts that receive from it, so queues are only included once the script has tried to receive from them.
+func (c *Channels) Pending(script *Script) map[string][]string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	pending := map[string][]string{}
+	for name, channel := range c.channels {
+		messages := channel.messages
+		if channel.Mode == ChannelModeBroadcast {
+			messages = messages[channel.cursor(script)-channel.first:]
+		} else if !channel.receivers[script] {
+			continue
+		}
+		if len(messages) > 0 {
+			pending[name] = append([]string{}, messages...)
+		}
+	}
+	return pending
+}
+
+func (c *Channels) add(name string, mode ChannelMode, capacity int) *Channel {
+	if capacity <= 0 {
+		capacity = DefaultChannelCapacity
+	}
+	channel := &Channel{
+		Capacity:  capacity,
+		Mode:      mode,
+		Name:      name,
+		cursors:   map[*Script]int{},
+		receivers: map[*Script]bool{},
+	}
+	c.channels[name] = channel
+	return channel
+}
+
+// get finds a channel, creating a queue if it does not exist yet.
+func (c *Channels) get(name string) *Channel {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if channel, ok := c.channels[name]; ok {
+		return channel
+	}
+	return c.add(name, ChannelModeQueue, 0)
+}
+
+// ready checks whether a script can send a message on a channel, or receive one from it.
+func (c *Channels) ready(channel *Channel, script *Script, receive bool) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if receive {
+		return channel.cursor(script) < channel.first+len(channel.messages)
+	}
+	return channel.Mode == ChannelModeBroadcast || len(channel.messages) < channel.Capacity
+}
+
+// receive takes the next message for a script from a channel, if there is one.
+func (c *Channels) receive(channel *Channel, script *Script) (string, bool) {
+	c.lock.Lock()
+	channel.receivers[script] = true
+	cursor := channel.cursor(script)
+	if cursor >= channel.first+len(channel.messages) {
+		c.lock.Unlock()
+		return "", false
+	}
+	value := channel.messages[cursor-channel.first]
+	if channel.Mode == ChannelModeBroadcast {
+		channel.cursors[script] = cursor + 1
+	} else {
+		channel.messages, channel.first = channel.messages[1:], channel.first+1
+	}
+	c.notify(channel)
+	return value, true
+}
+
+// send adds a message to a channel, unless it is a queue that is full.
+func (c *Channels) send(channel *Channel, value string) bool {
+	c.lock.Lock()
+	if len(channel.messages) >= channel.Capacity {
+		if channel.Mode != ChannelModeBroadcast {
+			c.lock.Unlock()
+			return false
+		}
+		channel.messages, channel.first = channel.messages[1:], channel.first+1
+	}
+	channel.messages = append(channel.messages, value)
+	c.notify(channel)
+	return true
+}
+
+// watch asks for a script to be woken up the next time a channel changes.
+func (c *Channels) watch(channel *Channel, wake func()) {
+	if wake == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	channel.watchers = append(channel.watchers, wake)
+}
+
+// notify unlocks the channels (which must be locked when it is called) and wakes up any scripts watching a channel.
+func (c *Channels) notify(channel *Channel) {
+	watchers := channel.watchers
+	channel.watchers = nil
+	c.lock.Unlock()
+	for _, wake := range watchers {
+		wake()
+	}
+}
+
+// forget removes a script that has stopped from all the channels.
+func (c *Channels) forget(script *Script) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, channel := range c.channels {
+		delete(channel.cursors, script)
+		delete(channel.receivers, script)
+	}
+}
+
+// cursor returns the sequence number of the next message a script receives from the channel.
+func (channel *Channel) cursor(script *Script) int {
+	if channel.Mode != ChannelModeBroadcast {
+		return channel.first
+	}
+	if cursor, ok := channel.cursors[script]; ok && cursor > channel.first {
+		return cursor
+	}
+	return channel.first
+}
+
+// channels returns the script's channels, creating them if it does not have any yet.
+func (s *Script) channels() *Channels {
+	if s.Channels == nil {
+		s.Channels = NewChannels()
+	}
+	return s.Channels
+}
+
+// messageFrame executes an `emit(channel='name', value='text')` call or a `receive(channel='name', into=&v):` block.
+// Both wait if the message cannot be sent or received straight away, for up to the optional timeout argument. Once
+// a message has been received the children of the receive block are executed.
+type messageFrame struct {
+	channel  *Channel
+	children bool
+	node     *Node
+	receive  bool
+	script   *Script
+	started  time.Time
+	timedOut bool
+	timeout  time.Duration
+	timer    *timer
+	value    string
+}
+
+func (f *messageFrame) current() *Node {
+	return f.node
+}
+
+func (f *messageFrame) step(t *task) {
+	s := t.script
+	switch {
+	case f.children:
+		t.pop(t.result)
+		return
+	case f.channel == nil:
+		if err := f.parse(s); err != nil {
+			t.pop(wrapRuntimeError(f.node, err))
+			return
+		}
+		s.tick(f.node)
+		f.script, f.started = s, s.now()
+	}
+
+	if f.receive {
+		if value, ok := s.Channels.receive(f.channel, s); ok {
+			f.stopWaiting(t)
+			s.trace(TraceMessageReceived, f.node, map[string]string{
+				"channel": f.channel.Name,
+				"value":   value,
+				"waited":  FormatDuration(s.now().Sub(f.started)),
+			}, "Received a message on '%s'", f.channel.Name)
+			if arg := newCall(s, f.node).Arg("into"); arg != nil {
+				s.setVariable(arg.Token.Value, value)
+			}
+			f.finish(t, nil)
+			return
+		}
+	} else if s.Channels.send(f.channel, f.value) {
+		f.stopWaiting(t)
+		s.trace(TraceMessageSent, f.node, map[string]string{
+			"channel": f.channel.Name,
+			"value":   f.value,
+		}, "Sent a message on '%s'", f.channel.Name)
+		f.finish(t, nil)
+		return
+	}
+
+	if f.timedOut {
+		what := "room on"
+		if f.receive {
+			what = "a message on"
+		}
+		err := newRuntimeError(f.node, "Timed out after %s waiting for %s '%s'", FormatDuration(f.timeout), what, f.channel.Name)
+		err.Code, err.Err = ErrorCodeTimeout, ErrMessageTimeout
+		f.finish(t, err)
+		return
+	}
+	if f.timeout > 0 && f.timer == nil {
+		f.timer = s.startTimer(f.timeout, func() {
+			f.timer, f.timedOut, t.blocked = nil, true, false
+		})
+	}
+	s.Channels.watch(f.channel, s.wake)
+	t.condition, t.blocked = f, true
+}
+
+// ready checks whether the message can now be sent or received.
+func (f *messageFrame) ready() bool {
+	return f.script.Channels.ready(f.channel, f.script, f.receive)
+}
+
+// cancel stops waiting when the frame is discarded.
+func (f *messageFrame) cancel(t *task) bool {
+	f.stopWaiting(t)
+	return false
+}
+
+func (f *messageFrame) finish(t *task, err error) {
+	t.script.setStatus(f.node, err)
+	if err == nil && f.receive && len(f.node.Children) > 0 {
+		f.children = true
+		t.push(&blockFrame{nodes: f.node.Children})
+		return
+	}
+	t.pop(err)
+}
+
+func (f *messageFrame) parse(s *Script) error {
+	call := newCall(s, f.node)
+	name, err := call.Value("channel")
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return newRuntimeError(f.node, "The channel of '%s' cannot be empty", f.node.Token.Value)
+	}
+	if f.receive {
+		if arg := call.Arg("into"); arg != nil && arg.Type != NodeVariable {
+			return fmt.Errorf("Argument 'into' must be a variable")
+		}
+	} else if f.value, err = call.Value("value"); err != nil {
+		return err
+	}
+	if call.Arg("timeout") != nil {
+		if f.timeout, err = call.Duration("timeout"); err != nil {
+			return err
+		}
+		if f.timeout <= 0 {
+			return newRuntimeError(f.node, "The timeout of '%s' must be more than zero", f.node.Token.Value)
+		}
+	}
+	f.channel = s.channels().get(name)
+	return nil
+}
+
+func (f *messageFrame) stopWaiting(t *task) {
+	if f.timer != nil {
+		t.script.stopTimer(f.timer)
+		f.timer = nil
+	}
+	if t.condition == f {
+		t.condition = nil
+	}
+}
@@ -0,0 +1,250 @@
+package robolang
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChannelsBetweenScripts(t *testing.T) {
+	var log []string
+	var events []string
+	channels := NewChannels()
+	scheduler := NewScheduler(nil)
+	guide := newChannelScript(t, "receive(channel='visitor', into=&v):\n  say(text='Welcome {&v}')", channels, &log)
+	guide.Tracer = TracerFunc(func(event *TraceEvent) {
+		if event.Kind == TraceMessageReceived {
+			events = append(events, event.Message+" "+event.Attributes["value"])
+		}
+	})
+	greeter := newChannelScript(t, "say(text='Hello')\nemit(channel='visitor', value='Bob')", channels, &log)
+	greeter.Tracer = TracerFunc(func(event *TraceEvent) {
+		if event.Kind == TraceMessageSent {
+			events = append(events, event.Message+" "+event.Attributes["value"])
+		}
+	})
+	addScheduledScript(t, scheduler, "guide", guide, 1)
+	addScheduledScript(t, scheduler, "greeter", greeter, 0)
+
+	scheduler.Run()
+	checkLog(t, log, "Hello,Welcome Bob")
+	checkLog(t, events, "Sent a message on 'visitor' Bob,Received a message on 'visitor' Bob")
+	for _, entry := range scheduler.Scripts {
+		if entry.Script.State != ScriptStateFinished {
+			t.Errorf("Unexpected state for '%s': expected %s, actual %s", entry.Name, ScriptStateFinished.String(), entry.Script.State.String())
+		}
+	}
+}
+
+func TestChannelModes(t *testing.T) {
+	tests := []struct {
+		mode     ChannelMode
+		expected string
+		waiting  int
+	}{
+		{ChannelModeQueue, "first news", 1},
+		{ChannelModeBroadcast, "first news,second news", 0},
+	}
+
+	for _, test := range tests {
+		var log []string
+		channels := NewChannels()
+		if _, err := channels.Add("news", test.mode, 0); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		scheduler := NewScheduler(nil)
+		addScheduledScript(t, scheduler, "first", newChannelScript(t, "receive(channel='news', into=&v):\n  say(text='first {&v}')", channels, &log), 1)
+		addScheduledScript(t, scheduler, "second", newChannelScript(t, "receive(channel='news', into=&v):\n  say(text='second {&v}')", channels, &log), 1)
+		addScheduledScript(t, scheduler, "sender", newChannelScript(t, "emit(channel='news', value='news')", channels, &log), 0)
+		scheduler.Run()
+		checkLog(t, log, test.expected)
+
+		waiting := 0
+		for _, entry := range scheduler.Scripts {
+			if entry.Script.State == ScriptStateWaiting {
+				waiting++
+			}
+		}
+		if waiting != test.waiting {
+			t.Errorf("Unexpected number of waiting scripts for %s: expected %d, got %d", test.mode.String(), test.waiting, waiting)
+		}
+	}
+}
+
+func TestChannelBuffering(t *testing.T) {
+	var log []string
+	channels := NewChannels()
+	if _, err := channels.Add("visitor", ChannelModeQueue, 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := channels.Add("visitor", ChannelModeQueue, 1); err == nil || err.Error() != "Channel visitor already exists" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	sender := newChannelScript(t, "emit(channel='visitor', value='a')\nemit(channel='visitor', value='b')\nsay(text='sent')", channels, &log)
+	receiver := newChannelScript(t, "waitForInput()\nreceive(channel='visitor', into=&v)\nsay(text='{&v}')\nreceive(channel='visitor', into=&v)\nsay(text='{&v}')", channels, &log)
+	if err := receiver.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := sender.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait")
+	if sender.State != ScriptStateWaiting {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateWaiting.String(), sender.State.String())
+	}
+	// The receiver has not used the queue yet, so its messages could go to any script
+	if actual := receiver.Snapshot().Messages; actual != nil {
+		t.Errorf("Unexpected pending messages: %v", actual)
+	}
+
+	if err := receiver.Resume(""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,input:,a")
+	if err := sender.Poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if actual := receiver.Snapshot().Messages; !reflect.DeepEqual(actual, map[string][]string{"visitor": {"b"}}) {
+		t.Errorf("Unexpected pending messages: %v", actual)
+	}
+	if actual := sender.Snapshot().Messages; actual != nil {
+		t.Errorf("Unexpected pending messages for the sender: %v", actual)
+	}
+	if err := receiver.Poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,input:,a,sent,b")
+	if actual := receiver.Snapshot().Messages; actual != nil {
+		t.Errorf("Unexpected pending messages: %v", actual)
+	}
+}
+
+func TestChannelBroadcastBuffer(t *testing.T) {
+	var log []string
+	channels := NewChannels()
+	if _, err := channels.Add("news", ChannelModeBroadcast, 2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sender := newChannelScript(t, "emit(channel='news', value='a')\nemit(channel='news', value='b')\nemit(channel='news', value='c')", channels, &log)
+	first := newChannelScript(t, "receive(channel='news', into=&v)\nsay(text='{&v}')", channels, &log)
+	// The second script has not received anything yet, so all the buffered messages are waiting for it
+	second := newChannelScript(t, "receive(channel='news')", channels, &log)
+	if err := sender.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := first.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "b")
+	// The first script has finished, so nothing is waiting for it any more
+	if actual := first.Snapshot().Messages; actual != nil {
+		t.Errorf("Unexpected pending messages: %v", actual)
+	}
+	if actual := second.Snapshot().Messages; !reflect.DeepEqual(actual, map[string][]string{"news": {"b", "c"}}) {
+		t.Errorf("Unexpected pending messages: %v", actual)
+	}
+}
+
+func TestChannelForgetsStoppedScripts(t *testing.T) {
+	var log []string
+	channels := NewChannels()
+	news, _ := channels.Add("news", ChannelModeBroadcast, 0)
+	sender := newChannelScript(t, "emit(channel='news', value='a')", channels, &log)
+	receiver := newChannelScript(t, "receive(channel='news', into=&v)\nsay(text='{&v}')\nreceive(channel='news')", channels, &log)
+	sender.Start()
+	receiver.Start()
+	checkLog(t, log, "a")
+	if len(news.cursors) != 1 || len(news.receivers) != 1 {
+		t.Errorf("Unexpected receivers: %v, %v", news.cursors, news.receivers)
+	}
+
+	if err := receiver.Cancel(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(news.cursors) != 0 || len(news.receivers) != 0 {
+		t.Errorf("Unexpected receivers after the script stopped: %v, %v", news.cursors, news.receivers)
+	}
+}
+
+func TestChannelTimeouts(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try():\n  receive(channel='visitor', into=&v, timeout=1s)\ncatch(error=&err):\n  say(text='{&err} ({&err.code})')", "Timed out after 1s waiting for a message on 'visitor' (timeout)"},
+		{"try():\n  emit(channel='full', value='a', timeout=1s)\n  emit(channel='full', value='b', timeout=1s)\ncatch(error=&err):\n  say(text='{&err} ({&err.code})')", "Timed out after 1s waiting for room on 'full' (timeout)"},
+	}
+
+	for _, test := range tests {
+		var log []string
+		clock := NewManualClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		channels := NewChannels()
+		if _, err := channels.Add("full", ChannelModeQueue, 1); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		script := newChannelScript(t, test.input, channels, &log)
+		script.Clock = clock
+		if err := script.Start(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		checkLog(t, log, "")
+		clock.Advance(time.Second)
+		if err := script.Poll(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		checkLog(t, log, test.expected)
+	}
+}
+
+func TestChannelErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"emit(channel='', value='a')", "The channel of 'emit' cannot be empty at line 0, pos 0"},
+		{"emit(channel='visitor')", "Missing argument 'value' at line 0, pos 0"},
+		{"receive(channel='visitor', into='v')", "Argument 'into' must be a variable at line 0, pos 0"},
+		{"receive(channel='visitor', timeout=0s)", "The timeout of 'receive' must be more than zero at line 0, pos 0"},
+	}
+
+	for _, test := range tests {
+		var log []string
+		script := newChannelScript(t, test.input, nil, &log)
+		if err := script.Start(); err == nil || err.Error() != test.err {
+			t.Errorf("Unexpected error for `%s`: expected %s, got %v", test.input, test.err, err)
+		}
+	}
+}
+
+func TestChannelsWithinScript(t *testing.T) {
+	var log []string
+	script := newChannelScript(t, "parallel():\n  receive(channel='c', into=&v):\n    say(text='got {&v}')\n  emit(channel='c', value='x')", nil, &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "got x")
+	if script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), script.State.String())
+	}
+}
+
+func TestChannelCancel(t *testing.T) {
+	var log []string
+	script := newChannelScript(t, "try():\n  receive(channel='c')\nfinally():\n  say(text='finally')", nil, &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := script.Cancel(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "finally")
+	if script.State != ScriptStateCancelled {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateCancelled.String(), script.State.String())
+	}
+}
+
+func newChannelScript(t *testing.T, input string, channels *Channels, log *[]string) *Script {
+	script := newTestScript(t, input, log)
+	script.Channels = channels
+	return script
+}
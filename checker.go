@@ -0,0 +1,214 @@
+package robolang
+
+import "strings"
+
+// Checker validates a parsed script before it is executed.
+type Checker struct {
+	Functions *FunctionTable
+	Variables *VariableTable
+
+	bound  map[string]bool
+	errors []error
+}
+
+// NewChecker starts a new checker
+func NewChecker(functions *FunctionTable) *Checker {
+	return &Checker{Functions: functions}
+}
+
+// Check validates the nodes and returns any problems found
+func (c *Checker) Check(nodes []*Node) []error {
+	c.errors = nil
+	c.bound = map[string]bool{}
+	c.checkNodes(nodes)
+	c.checkStates(nodes)
+	return c.errors
+}
+
+func (c *Checker) addError(tok *Token, format string, a ...interface{}) {
+	c.errors = append(c.errors, newParseError(tok, format, a...))
+}
+
+// builtinOutputs maps the built-in functions to the argument they set (e.g. catch(error=&err))
+var builtinOutputs = map[string]string{
+	catchFunction:   "error",
+	receiveFunction: "into",
+	retryFunction:   "attempt",
+	spawnFunction:   "handle",
+}
+
+// bindOutputs marks the variables that a function sets (e.g. set(variable=&count)) as bound, so they can be used by
+// anything that comes after the function in the script.
+func (c *Checker) bindOutputs(node *Node) {
+	if node.Token.Value == retryFunction && newCall(nil, node).Arg("attempt") == nil {
+		c.bound["attempt"] = true
+	}
+	for _, arg := range node.Args {
+		if !c.isOutput(node.Token.Value, arg.Token.Value) {
+			continue
+		}
+		for _, value := range arg.Children {
+			if value.Type == NodeVariable {
+				c.bound[strings.SplitN(value.Token.Value, ".", 2)[0]] = true
+			}
+		}
+	}
+}
+
+// isOutput checks whether an argument of a function is a variable that the function sets, rather than reads.
+func (c *Checker) isOutput(function, name string) bool {
+	if builtinOutputs[function] == name {
+		return true
+	}
+	definition, ok := c.Functions.Get(function)
+	if !ok {
+		return false
+	}
+	param, ok := definition.Parameter(name)
+	return ok && param.Output
+}
+
+func (c *Checker) checkFunction(node *Node) {
+	if c.Functions == nil {
+		return
+	}
+	function, ok := c.Functions.Get(node.Token.Value)
+	if !ok {
+		return
+	}
+
+	for _, arg := range node.Args {
+		param, ok := function.Parameter(arg.Token.Value)
+		if !ok || param.Units == UnitNone {
+			continue
+		}
+		for _, value := range arg.Children {
+			if value.Quantity != nil && value.Quantity.Family != param.Units {
+				c.addError(value.Token, "Argument '%s' of '%s' expects %s, found %s",
+					arg.Token.Value,
+					node.Token.Value,
+					param.Units.Name(),
+					value.Quantity.Family.Name())
+			}
+		}
+	}
+}
+
+func (c *Checker) checkNodes(nodes []*Node) {
+	for _, node := range nodes {
+		switch node.Type {
+		case NodeFunction:
+			c.checkFunction(node)
+		case NodeTemplate:
+			c.checkTemplate(node)
+		}
+		c.checkNodes(node.Args)
+		if node.Type == NodeFunction {
+			// Variables are only bound for the nodes that come after the function that sets them
+			c.bindOutputs(node)
+		}
+		c.checkNodes(node.Children)
+	}
+}
+
+func (c *Checker) checkTemplate(node *Node) {
+	for _, child := range node.Children {
+		if child.Type != NodeVariable {
+			continue
+		}
+		name := strings.SplitN(child.Token.Value, ".", 2)[0]
+		if c.bound[name] {
+			continue
+		}
+		if _, ok := c.Variables.Get(name); ok {
+			continue
+		}
+		c.addError(child.Token, "Unknown variable '%s' in text", child.Token.Value)
+	}
+}
+
+// checkStates makes sure every transition goes to a known state, and every state can be reached from the initial
+// state (the first one declared) or a transition outside the state machine.
+func (c *Checker) checkStates(nodes []*Node) {
+	states := map[string]*Node{}
+	var order []string
+	for _, node := range nodes {
+		name, ok := stateName(node)
+		if !ok {
+			continue
+		}
+		if _, exists := states[name]; exists {
+			c.addError(node.Token, "State '%s' has already been declared", name)
+			continue
+		}
+		states[name] = node
+		order = append(order, name)
+	}
+
+	// Work out which states each state (or the rest of the script) can change to
+	transitions := map[string][]string{}
+	dynamic := false
+	var findTransitions func(from string, nodes []*Node)
+	findTransitions = func(from string, nodes []*Node) {
+		for _, node := range nodes {
+			if node.Type == NodeFunction && node.Token.Value == gotoFunction {
+				target, ok := constantArg(node, "state")
+				if !ok {
+					dynamic = true
+				} else if _, exists := states[target.Token.Value]; !exists {
+					c.addError(target.Token, "Unknown state '%s'", target.Token.Value)
+				} else {
+					transitions[from] = append(transitions[from], target.Token.Value)
+				}
+			}
+			findTransitions(from, node.Children)
+		}
+	}
+	for _, node := range nodes {
+		if name, ok := stateName(node); ok {
+			findTransitions(name, node.Children)
+		} else {
+			findTransitions("", []*Node{node})
+		}
+	}
+	if len(order) == 0 || dynamic {
+		return
+	}
+
+	reached := map[string]bool{}
+	pending := append([]string{order[0]}, transitions[""]...)
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if !reached[name] {
+			reached[name] = true
+			pending = append(pending, transitions[name]...)
+		}
+	}
+	for _, name := range order {
+		if !reached[name] {
+			c.addError(states[name].Token, "State '%s' can never be reached", name)
+		}
+	}
+}
+
+// constantArg returns the value of an argument if it is a constant.
+func constantArg(node *Node, name string) (*Node, bool) {
+	for _, arg := range node.Args {
+		if arg.Token.Value == name && len(arg.Children) == 1 && arg.Children[0].Type == NodeConstant {
+			return arg.Children[0], true
+		}
+	}
+	return nil, false
+}
+
+func stateName(node *Node) (string, bool) {
+	if node.Type != NodeFunction || node.Token.Value != stateFunction {
+		return "", false
+	}
+	name, ok := constantArg(node, "name")
+	if !ok {
+		return "", false
+	}
+	return name.Token.Value, true
+}
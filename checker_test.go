@@ -0,0 +1,98 @@
+package robolang
+
+import "testing"
+
+func TestCheckUnits(t *testing.T) {
+	functions := NewFunctionTable(
+		NewFunction("move").AddParameter("distance", UnitLength),
+		NewFunction("turn").AddParameter("angle", UnitAngle),
+		NewFunction("say").AddParameter("text", UnitNone))
+	tests := []struct {
+		input  string
+		errors int
+	}{
+		{"move(distance=30cm)", 0},
+		{"move(distance=30)", 0},
+		{"move(distance=90deg)", 1},
+		{"turn(angle=90deg)", 0},
+		{"turn(angle=5s)", 1},
+		{"say(text=5s)", 0},
+		{"unknown(value=5s)", 0},
+		{"waitForInput():\n  move(distance=40%)\n  turn(angle=1cm)", 2},
+	}
+	for _, test := range tests {
+		result := NewParser(test.input).Parse()
+		if len(result.Errors) > 0 {
+			t.Errorf("Unexpected errors while parsing `%s`: [%v]", test.input, result.Errors)
+			continue
+		}
+		errs := NewChecker(functions).Check(result.Nodes)
+		if len(errs) != test.errors {
+			t.Errorf("Unexpected errors for `%s`: expected %d, found %v", test.input, test.errors, errs)
+		}
+	}
+}
+
+func TestCheckTemplateVariables(t *testing.T) {
+	tests := []struct {
+		input  string
+		errors int
+	}{
+		{"say(text='Hello {&name}')", 0},
+		{"say(text='You have {&count} stars')", 1},
+		{"set(variable=&count,value=1)\nsay(text='You have {&count} stars')", 0},
+		{"say(text='{&count} of {&total}')", 2},
+		// Variables can only be used after they have been set
+		{"say(text='You have {&count} stars')\nset(variable=&count,value=1)", 1},
+		// Reading a variable does not set it
+		{"say(text=&count)\nsay(text='You have {&count} stars')", 1},
+		{"set(variable=&count,value=&total)\nsay(text='{&count} of {&total}')", 1},
+		{"try():\n  fail()\ncatch(error=&err):\n  say(text='{&err.code}')", 0},
+		{"receive(channel='visitor', into=&v):\n  say(text='Hello {&v}')", 0},
+		{"retry():\n  say(text='Attempt {&attempt}')", 0},
+	}
+	for _, test := range tests {
+		result := NewParser(test.input).Parse()
+		if len(result.Errors) > 0 {
+			t.Errorf("Unexpected errors while parsing `%s`: [%v]", test.input, result.Errors)
+			continue
+		}
+		checker := NewChecker(NewFunctionTable(NewFunction("set").AddOutput("variable").AddParameter("value", UnitNone)))
+		checker.Variables = NewVariableTable(NewVariable("name"))
+		errs := checker.Check(result.Nodes)
+		if len(errs) != test.errors {
+			t.Errorf("Unexpected errors for `%s`: expected %d, found %v", test.input, test.errors, errs)
+		}
+	}
+}
+
+func TestCheckStates(t *testing.T) {
+	tests := []struct {
+		input  string
+		errors []string
+	}{
+		{"state(name='idle'):\n  goto(state='busy')\nstate(name='busy'):\n  goto(state='idle')", nil},
+		{"state(name='idle'):\n  goto(state='missing')", []string{"Unknown state 'missing' at line 1, pos 13"}},
+		{"state(name='idle'):\n  clear()\nstate(name='lost'):\n  goto(state='idle')", []string{"State 'lost' can never be reached at line 2, pos 0"}},
+		{"on(event='found'):\n  goto(state='lost')\nstate(name='idle'):\n  clear()\nstate(name='lost'):\n  clear()", nil},
+		{"goto(state=&next)\nstate(name='idle'):\n  clear()\nstate(name='lost'):\n  clear()", nil},
+		{"state(name='idle'):\n  clear()\nstate(name='idle'):\n  clear()", []string{"State 'idle' has already been declared at line 2, pos 0"}},
+	}
+	for _, test := range tests {
+		result := NewParser(test.input).Parse()
+		if len(result.Errors) > 0 {
+			t.Errorf("Unexpected errors while parsing `%s`: [%v]", test.input, result.Errors)
+			continue
+		}
+		errs := NewChecker(nil).Check(result.Nodes)
+		if len(errs) != len(test.errors) {
+			t.Errorf("Unexpected errors for `%s`: expected %v, found %v", test.input, test.errors, errs)
+			continue
+		}
+		for pos, err := range errs {
+			if err.Error() != test.errors[pos] {
+				t.Errorf("Unexpected error for `%s`: expected [%s], found [%v]", test.input, test.errors[pos], err)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package robolang
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock provides the current time to a script. Scripts use the system clock unless another clock is set, which
+// allows tests to control time without sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is a clock that uses the system time
+type SystemClock struct{}
+
+// Now returns the current system time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock is a clock that only moves when it is told to
+type ManualClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+// NewManualClock starts a new manual clock at a time
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the current time of the clock
+func (clock *ManualClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return clock.now
+}
+
+// Advance moves the clock forward
+func (clock *ManualClock) Advance(d time.Duration) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	clock.now = clock.now.Add(d)
+}
+
+// timer calls fire once the clock reaches deadline.
+type timer struct {
+	deadline time.Time
+	fire     func()
+}
+
+// NextDeadline returns when the next timer in the script expires, so the host knows when to call Poll.
+func (s *Script) NextDeadline() (time.Time, bool) {
+	if len(s.timers) == 0 {
+		return time.Time{}, false
+	}
+	return s.timers[0].deadline, true
+}
+
+// Poll fires any timers that have expired and continues executing the script, including a script that gave up
+// control part way through a loop.
+func (s *Script) Poll() error {
+	if s.State != ScriptStateWaiting && s.State != ScriptStatePaused {
+		return ErrScriptNotRunning
+	}
+	return s.run()
+}
+
+func (s *Script) now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+	return s.Clock.Now()
+}
+
+func (s *Script) startTimer(d time.Duration, fire func()) *timer {
+	tm := &timer{
+		deadline: s.now().Add(d),
+		fire:     fire,
+	}
+	s.timers = append(s.timers, tm)
+	sort.SliceStable(s.timers, func(i, j int) bool {
+		return s.timers[i].deadline.Before(s.timers[j].deadline)
+	})
+	return tm
+}
+
+func (s *Script) stopTimer(tm *timer) {
+	for pos, other := range s.timers {
+		if other == tm {
+			s.timers = append(s.timers[:pos], s.timers[pos+1:]...)
+			return
+		}
+	}
+}
+
+// fireTimers fires all the timers that have expired, in the order they expired.
+func (s *Script) fireTimers() {
+	now := s.now()
+	for len(s.timers) > 0 && !s.timers[0].deadline.After(now) {
+		tm := s.timers[0]
+		s.timers = s.timers[1:]
+		tm.fire()
+	}
+}
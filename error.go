@@ -0,0 +1,124 @@
+package robolang
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Error codes for runtime errors
+const (
+	// ErrorCodeCancelled means the script was cancelled
+	ErrorCodeCancelled = "cancelled"
+
+	// ErrorCodeFailed means a behaviour (e.g. a condition) failed
+	ErrorCodeFailed = "failed"
+
+	// ErrorCodeFunction means a function returned an error
+	ErrorCodeFunction = "function"
+
+	// ErrorCodeScript means there is a problem with the script itself (e.g. an invalid argument)
+	ErrorCodeScript = "script"
+
+	// ErrorCodeTimeout means a withTimeout block ran out of time
+	ErrorCodeTimeout = "timeout"
+
+	// ErrorCodeUnknownFunction means the script called a function that does not exist
+	ErrorCodeUnknownFunction = "unknownFunction"
+)
+
+// RuntimeError provides a consistent format for reporting errors while executing a script
+type RuntimeError struct {
+	Code         string
+	Err          error
+	File         string
+	LineNumber   int
+	LinePosition int
+	Message      string
+
+	located bool
+}
+
+// NewError starts a new runtime error with a code, for functions that need to report a specific type of error. The
+// location is added when the error is returned from the function.
+func NewError(code, format string, a ...interface{}) *RuntimeError {
+	return &RuntimeError{
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+// Error converts this struct into an error message
+func (err *RuntimeError) Error() string {
+	if err.File != "" {
+		return fmt.Sprintf("%s in %s at line %d, pos %d", err.Message, err.File, err.LineNumber, err.LinePosition)
+	}
+	return fmt.Sprintf("%s at line %d, pos %d", err.Message, err.LineNumber, err.LinePosition)
+}
+
+// Unwrap returns the underlying error (if any)
+func (err *RuntimeError) Unwrap() error {
+	return err.Err
+}
+
+// fields converts the error into the fields of a script variable.
+func (err *RuntimeError) fields() map[string]string {
+	return map[string]string{
+		"code":    err.Code,
+		"file":    err.File,
+		"line":    strconv.Itoa(err.LineNumber),
+		"message": err.Message,
+		"pos":     strconv.Itoa(err.LinePosition),
+	}
+}
+
+func newRuntimeError(node *Node, format string, a ...interface{}) *RuntimeError {
+	err := &RuntimeError{
+		Code:    ErrorCodeScript,
+		Message: fmt.Sprintf(format, a...),
+	}
+	err.locate(node)
+	return err
+}
+
+func (err *RuntimeError) locate(node *Node) {
+	if node != nil && node.Token != nil {
+		err.File, err.LineNumber, err.LinePosition = node.Token.File, node.Token.LineNum, node.Token.LinePos
+		err.located = true
+	}
+}
+
+// wrapRuntimeError adds the location of a node to an error, unless it already has a location.
+func wrapRuntimeError(node *Node, err error) error {
+	var existing *RuntimeError
+	if errors.As(err, &existing) {
+		if existing.located {
+			return err
+		}
+		located := *existing
+		located.locate(node)
+		return &located
+	}
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		return &RuntimeError{
+			Code:         ErrorCodeScript,
+			Err:          err,
+			File:         parseErr.File,
+			LineNumber:   parseErr.LineNumber,
+			LinePosition: parseErr.LinePosition,
+			Message:      parseErr.Message,
+			located:      true,
+		}
+	}
+	wrapped := newRuntimeError(node, "%v", err)
+	wrapped.Code, wrapped.Err = ErrorCodeFunction, err
+	return wrapped
+}
+
+// asRuntimeError converts any error into a runtime error.
+func asRuntimeError(node *Node, err error) *RuntimeError {
+	var rt *RuntimeError
+	errors.As(wrapRuntimeError(node, err), &rt)
+	return rt
+}
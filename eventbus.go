@@ -0,0 +1,275 @@
+package robolang
+
+import (
+	"strings"
+	"sync"
+)
+
+// DefaultQueueCapacity is the number of events a subscription holds when no capacity is given
+const DefaultQueueCapacity = 64
+
+// EventType defines how an event is delivered to a script
+type EventType int
+
+//go:generate stringer -type=EventType
+
+const (
+	// EventTypeSignal triggers any `on(event='topic'):` handlers for the event's topic
+	EventTypeSignal EventType = iota
+
+	// EventTypeInput is passed to the functions that are waiting for input, in the same way as Script.Resume. It
+	// stays in the queue until a function is waiting.
+	EventTypeInput
+)
+
+// DropPolicy defines what happens when an event is published to a subscription whose queue is full
+type DropPolicy int
+
+//go:generate stringer -type=DropPolicy
+
+const (
+	// DropPolicyOldest discards the oldest event in the queue to make room for the new one
+	DropPolicyOldest DropPolicy = iota
+
+	// DropPolicyNewest discards the new event, keeping the queue as it is
+	DropPolicyNewest
+)
+
+// Event is something that happened outside a script, such as a button press, a sensor reading or recognised speech
+type Event struct {
+	Data     map[string]string `json:"data,omitempty"`
+	Topic    string            `json:"topic"`
+	Type     EventType         `json:"-"`
+	TypeText string            `json:"type"`
+	Value    string            `json:"value,omitempty"`
+}
+
+// NewInputEvent creates an event that passes a value to the functions waiting for input
+func NewInputEvent(topic, value string) *Event {
+	return &Event{Topic: topic, Type: EventTypeInput, TypeText: EventTypeInput.String(), Value: value}
+}
+
+// NewSignalEvent creates an event that triggers the handlers for its topic
+func NewSignalEvent(topic string) *Event {
+	return &Event{Topic: topic, Type: EventTypeSignal, TypeText: EventTypeSignal.String()}
+}
+
+// EventBus routes events from the host (sensors, buttons, speech recognisers, a web UI, or a test) to the scripts
+// that have subscribed to them. Each script has its own bounded queue, and takes events from it at node boundaries.
+//
+// Scripts run by a Scheduler or with Run pick up new events straight away, other scripts pick them up the next time
+// they are started, resumed or polled. An event bus can be used from any goroutine.
+type EventBus struct {
+	lock          sync.Mutex
+	subscriptions []*Subscription
+}
+
+// Subscription is a script's queue of events from an event bus
+type Subscription struct {
+	Capacity int
+	Filters  []string
+	Policy   DropPolicy
+
+	bus     *EventBus
+	closed  bool
+	dropped int
+	queue   []*Event
+	script  *Script
+	wake    func()
+}
+
+// NewEventBus creates a new event bus
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe adds a queue of events for a script, which should be called before the script is started. A script only
+// has one subscription, so subscribing again replaces (and unsubscribes) the previous one. The filters
+// select the topics the script receives: topics are separated by slashes, and in a filter `*` matches any single
+// level (e.g. button/*) while a final `**` matches any number of levels (e.g. sensors/**). Without any filters the
+// script receives every event.
+func (bus *EventBus) Subscribe(script *Script, capacity int, policy DropPolicy, filters ...string) *Subscription {
+	if capacity <= 0 {
+		capacity = DefaultQueueCapacity
+	}
+	sub := &Subscription{
+		Capacity: capacity,
+		Filters:  filters,
+		Policy:   policy,
+		bus:      bus,
+		script:   script,
+		wake:     script.wake,
+	}
+	if old := script.events; old != nil {
+		old.bus.Unsubscribe(old)
+	}
+	bus.lock.Lock()
+	bus.subscriptions = append(bus.subscriptions, sub)
+	bus.lock.Unlock()
+	script.events = sub
+	return sub
+}
+
+// Unsubscribe stops sending events to a subscription, and discards any events still in its queue.
+func (bus *EventBus) Unsubscribe(sub *Subscription) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	for pos, other := range bus.subscriptions {
+		if other == sub {
+			bus.subscriptions = append(bus.subscriptions[:pos], bus.subscriptions[pos+1:]...)
+			break
+		}
+	}
+	sub.closed, sub.queue = true, nil
+}
+
+// Publish sends an event to every subscription with a matching filter, and returns how many subscriptions it was
+// queued for.
+func (bus *EventBus) Publish(event *Event) int {
+	var wake []func()
+	count := 0
+	bus.lock.Lock()
+	for _, sub := range bus.subscriptions {
+		if !sub.matches(event.Topic) {
+			continue
+		}
+		if len(sub.queue) >= sub.capacity() {
+			sub.dropped++
+			if sub.Policy == DropPolicyNewest {
+				continue
+			}
+			sub.queue = sub.queue[1:]
+		}
+		sub.queue = append(sub.queue, event)
+		count++
+		if fn := sub.wake; fn != nil {
+			wake = append(wake, fn)
+		}
+	}
+	bus.lock.Unlock()
+
+	for _, fn := range wake {
+		fn()
+	}
+	return count
+}
+
+// Dropped returns the number of events that have been discarded because the queue was full
+func (sub *Subscription) Dropped() int {
+	sub.bus.lock.Lock()
+	defer sub.bus.lock.Unlock()
+	return sub.dropped
+}
+
+// Len returns the number of events waiting in the queue
+func (sub *Subscription) Len() int {
+	sub.bus.lock.Lock()
+	defer sub.bus.lock.Unlock()
+	return len(sub.queue)
+}
+
+// capacity returns the size of the queue, using the default if the capacity has been changed to an invalid value.
+func (sub *Subscription) capacity() int {
+	if sub.Capacity <= 0 {
+		return DefaultQueueCapacity
+	}
+	return sub.Capacity
+}
+
+func (sub *Subscription) matches(topic string) bool {
+	if len(sub.Filters) == 0 {
+		return true
+	}
+	for _, filter := range sub.Filters {
+		if matchTopic(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// next removes the first event that the script can use now from the queue: signals can always be used, but input
+// can only be used while a function is waiting for it.
+func (sub *Subscription) next(input bool) *Event {
+	sub.bus.lock.Lock()
+	defer sub.bus.lock.Unlock()
+	for pos, event := range sub.queue {
+		if event.Type != EventTypeInput || input {
+			sub.queue = append(sub.queue[:pos:pos], sub.queue[pos+1:]...)
+			return event
+		}
+	}
+	return nil
+}
+
+// ready checks whether the queue has an event that the script can use now.
+func (sub *Subscription) ready(input bool) bool {
+	sub.bus.lock.Lock()
+	defer sub.bus.lock.Unlock()
+	for _, event := range sub.queue {
+		if event.Type != EventTypeInput || input {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTopic checks whether a topic matches a filter, where `*` matches any single level and a final `**` matches
+// any number of levels.
+func matchTopic(filter, topic string) bool {
+	filters, topics := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for pos, part := range filters {
+		if part == "**" && pos == len(filters)-1 {
+			return true
+		}
+		if pos >= len(topics) || (part != "*" && part != topics[pos]) {
+			return false
+		}
+	}
+	return len(filters) == len(topics)
+}
+
+// deliverEvents takes any events that the script can use from its subscription: signals trigger handlers, and each
+// input is passed to one of the functions waiting for it.
+func (s *Script) deliverEvents() {
+	for {
+		event := s.events.next(s.waitingForInput())
+		if event == nil {
+			return
+		}
+		switch event.Type {
+		case EventTypeInput:
+			s.resume(event.Value, event)
+		case EventTypeSignal:
+			if !s.cancelled {
+				s.raise(event.Topic)
+			}
+		}
+	}
+}
+
+// setWake sets the function that wakes up the host running the script. It is passed on to the script's subscription
+// (if any) under the bus lock, as Publish uses it from other goroutines.
+func (s *Script) setWake(wake func()) {
+	s.wake = wake
+	if sub := s.events; sub != nil {
+		sub.bus.lock.Lock()
+		sub.wake = wake
+		sub.bus.lock.Unlock()
+	}
+}
+
+// eventsReady checks whether the script has any events that it can use now.
+func (s *Script) eventsReady() bool {
+	return s.events != nil && s.events.ready(s.waitingForInput())
+}
+
+// waitingForInput checks whether any functions are waiting for input.
+func (s *Script) waitingForInput() bool {
+	for _, t := range s.tasks {
+		if t.waitingCall() != nil {
+			return true
+		}
+	}
+	return false
+}
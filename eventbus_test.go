@@ -0,0 +1,221 @@
+package robolang
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter   string
+		topic    string
+		expected bool
+	}{
+		{"button/pressed", "button/pressed", true},
+		{"button/pressed", "button/released", false},
+		{"button/*", "button/released", true},
+		{"button/*", "button", false},
+		{"button/*", "button/left/pressed", false},
+		{"*/pressed", "button/pressed", true},
+		{"sensors/**", "sensors/battery/level", true},
+		{"sensors/**", "sensors", true},
+		{"sensors/**", "speech/heard", false},
+		{"**", "anything/at/all", true},
+		{"speech", "speech/heard", false},
+	}
+
+	for _, test := range tests {
+		if actual := matchTopic(test.filter, test.topic); actual != test.expected {
+			t.Errorf("Unexpected match for %s against %s: expected %t, got %t", test.filter, test.topic, test.expected, actual)
+		}
+	}
+}
+
+func TestEventBusInput(t *testing.T) {
+	var log []string
+	bus := NewEventBus()
+	script := newTestScript(t, "waitForInput()\nheard()\nwaitForInput()", &log)
+	script.Functions.Functions["heard"] = NewFunction("heard").SetFunction(FunctionFunc(func(call *Call) error {
+		log = append(log, "heard")
+		return nil
+	}))
+	var topics []string
+	script.Functions.Functions["waitForInput"].Function = &eventInput{waitForInput: waitForInput{log: &log}, topics: &topics}
+	bus.Subscribe(script, 0, DropPolicyOldest, "speech/*")
+
+	// Input published before the script is waiting is kept until it is
+	if count := bus.Publish(NewInputEvent("speech/heard", "hello")); count != 1 {
+		t.Errorf("Unexpected number of deliveries: expected 1, got %d", count)
+	}
+	if count := bus.Publish(NewInputEvent("button/pressed", "ignored")); count != 0 {
+		t.Errorf("Unexpected number of deliveries: expected 0, got %d", count)
+	}
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,input:hello,heard,wait")
+
+	bus.Publish(NewInputEvent("speech/heard", "goodbye"))
+	if err := script.Poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,input:hello,heard,wait,input:goodbye")
+	checkLog(t, topics, "speech/heard,speech/heard")
+	if script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), script.State.String())
+	}
+}
+
+func TestEventBusSignals(t *testing.T) {
+	var log []string
+	bus := NewEventBus()
+	script := newTestScript(t, "on(event='button/pressed', mode='interrupt'):\n  say(text='pressed')\nwaitForInput()\nsay(text='done')", &log)
+	bus.Subscribe(script, 0, DropPolicyOldest)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	bus.Publish(NewSignalEvent("button/pressed"))
+	bus.Publish(NewSignalEvent("button/released"))
+	if err := script.Poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,pressed")
+
+	// The interrupt handler runs before the function that was waiting carries on
+	bus.Publish(NewInputEvent("ui/input", "go"))
+	bus.Publish(NewSignalEvent("button/pressed"))
+	if err := script.Poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,pressed,pressed,input:go,done")
+}
+
+func TestEventBusDropPolicies(t *testing.T) {
+	tests := []struct {
+		policy   DropPolicy
+		expected string
+	}{
+		{DropPolicyOldest, "wait,input:b,wait,input:c,wait"},
+		{DropPolicyNewest, "wait,input:a,wait,input:b,wait"},
+	}
+
+	for _, test := range tests {
+		var log []string
+		bus := NewEventBus()
+		script := newTestScript(t, "waitForInput()\nwaitForInput()\nwaitForInput()", &log)
+		sub := bus.Subscribe(script, 2, test.policy)
+		for _, value := range []string{"a", "b", "c"} {
+			bus.Publish(NewInputEvent("input", value))
+		}
+		if sub.Dropped() != 1 || sub.Len() != 2 {
+			t.Errorf("Unexpected queue for %s: %d dropped, %d queued", test.policy.String(), sub.Dropped(), sub.Len())
+		}
+		if err := script.Start(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		checkLog(t, log, test.expected)
+	}
+}
+
+func TestEventBusUnsubscribe(t *testing.T) {
+	var log []string
+	bus := NewEventBus()
+	script := newTestScript(t, "waitForInput()", &log)
+	sub := bus.Subscribe(script, 0, DropPolicyOldest)
+	bus.Publish(NewInputEvent("input", "a"))
+	bus.Unsubscribe(sub)
+	if count := bus.Publish(NewInputEvent("input", "b")); count != 0 {
+		t.Errorf("Unexpected number of deliveries: expected 0, got %d", count)
+	}
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait")
+}
+
+func TestEventBusResubscribe(t *testing.T) {
+	var log []string
+	bus := NewEventBus()
+	script := newTestScript(t, "waitForInput()", &log)
+	first := bus.Subscribe(script, 0, DropPolicyOldest, "first")
+	second := bus.Subscribe(script, 0, DropPolicyOldest, "second")
+	if count := bus.Publish(NewInputEvent("first", "a")); count != 0 || first.Len() != 0 {
+		t.Errorf("Unexpected delivery to the replaced subscription: %d delivered, %d queued", count, first.Len())
+	}
+
+	// Invalid capacities fall back to the default
+	second.Capacity = 0
+	for count := 0; count <= DefaultQueueCapacity; count++ {
+		bus.Publish(NewInputEvent("second", "b"))
+	}
+	if second.Len() != DefaultQueueCapacity || second.Dropped() != 1 {
+		t.Errorf("Unexpected queue: %d dropped, %d queued", second.Dropped(), second.Len())
+	}
+}
+
+func TestEventBusWakesScripts(t *testing.T) {
+	var log []string
+	bus := NewEventBus()
+	scheduler := NewScheduler(nil)
+	scheduled := newTestScript(t, "waitForInput()", &log)
+	bus.Subscribe(scheduled, 0, DropPolicyOldest, "scheduled")
+	addScheduledScript(t, scheduler, "scheduled", scheduled, 0)
+	scheduler.Run()
+	bus.Publish(NewInputEvent("scheduled", "a"))
+	scheduler.Run()
+	checkLog(t, log, "wait,input:a")
+
+	var executionLog []string
+	script := newTestScript(t, "waitForInput()", &executionLog)
+	bus.Subscribe(script, 0, DropPolicyOldest, "execution")
+	execution, err := script.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForState(t, execution, ScriptStateWaiting)
+	bus.Publish(NewInputEvent("execution", "b"))
+	if err := execution.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, executionLog, "wait,input:b")
+}
+
+func TestEventBusPublishWhileRunning(t *testing.T) {
+	var log []string
+	bus := NewEventBus()
+	script := newTestScript(t, "waitForInput()", &log)
+	bus.Subscribe(script, 2000, DropPolicyOldest)
+
+	// Publish from another goroutine while the script starts and finishes
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for count := 0; count < 1000; count++ {
+			bus.Publish(NewSignalEvent("tick"))
+		}
+	}()
+	execution, err := script.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bus.Publish(NewInputEvent("input", "a"))
+	if err := execution.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-published
+	checkLog(t, log, "wait,input:a")
+}
+
+// eventInput is a waitForInput function that also records the topic of the event that resumed it.
+type eventInput struct {
+	waitForInput
+	topics *[]string
+}
+
+func (fn *eventInput) Resume(call *Call) error {
+	if call.Event != nil {
+		*fn.topics = append(*fn.topics, call.Event.Topic)
+	}
+	return fn.waitForInput.Resume(call)
+}
@@ -0,0 +1,294 @@
+package robolang
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Execution is a handle to a script that is running in the background, started by Script.Run. All the methods are
+// safe to call from any goroutine.
+//
+// The script itself is still executed cooperatively: a single goroutine runs every task in the script, and only
+// stops between node boundaries to let other goroutines pause, inspect or stop it.
+type Execution struct {
+	changes  chan ScriptState
+	commands chan *executionCommand
+	ctx      context.Context
+	done     chan struct{}
+	err      error
+	last     ScriptState
+	lock     sync.Mutex
+	paused   bool
+	pending  []*executionCommand
+	script   *Script
+	wake     chan struct{}
+}
+
+type executionCommand struct {
+	deferrable bool
+	run        func() error
+}
+
+// Run starts executing the script in the background, and returns a handle to control it. The script stops when the
+// context is cancelled.
+func (s *Script) Run(ctx context.Context) (*Execution, error) {
+	if s.State != ScriptStatePending || s.yield != nil {
+		return nil, ErrScriptNotRunning
+	}
+	e := &Execution{
+		changes:  make(chan ScriptState, 32),
+		commands: make(chan *executionCommand, 16),
+		ctx:      ctx,
+		done:     make(chan struct{}),
+		last:     s.State,
+		script:   s,
+		wake:     make(chan struct{}, 1),
+	}
+	s.setWake(e.notify)
+	s.yield = e.yield
+	go e.loop()
+	return e, nil
+}
+
+// Changes returns a channel that receives the new state every time the state of the script changes. The channel is
+// closed when the script stops. If nothing reads the changes the oldest ones are dropped, so the script is never
+// blocked.
+func (e *Execution) Changes() <-chan ScriptState {
+	return e.changes
+}
+
+// CurrentNode returns the node that the script executed most recently
+func (e *Execution) CurrentNode() *Node {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.script.CurrentNode()
+}
+
+// Done returns a channel that is closed when the script stops
+func (e *Execution) Done() <-chan struct{} {
+	return e.done
+}
+
+// Input passes input to any functions that are waiting for it. If the script is paused the input is passed on
+// when it is resumed.
+func (e *Execution) Input(input string) error {
+	return e.send(&executionCommand{
+		deferrable: true,
+		run: func() error {
+			return e.script.Resume(input)
+		},
+	})
+}
+
+// Pause stops the script at the next node boundary, until Resume is called. Timers (e.g. timeouts) do not fire
+// while the script is paused.
+func (e *Execution) Pause() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.isDone() {
+		return ErrScriptNotRunning
+	}
+	e.paused = true
+	if e.script.State == ScriptStateWaiting {
+		e.script.State = ScriptStatePaused
+	}
+	e.notify()
+	return nil
+}
+
+// Raise triggers any handlers for an event. If the script is paused the event is raised when it is resumed.
+func (e *Execution) Raise(event string) error {
+	return e.send(&executionCommand{
+		deferrable: true,
+		run: func() error {
+			return e.script.Raise(event)
+		},
+	})
+}
+
+// Resume continues a paused script from where it stopped
+func (e *Execution) Resume() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.isDone() {
+		return ErrScriptNotRunning
+	}
+	e.paused = false
+	e.notify()
+	return nil
+}
+
+// Snapshot captures the current state of the script
+func (e *Execution) Snapshot() *Snapshot {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.script.Snapshot()
+}
+
+// State returns the current state of the script
+func (e *Execution) State() ScriptState {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.script.State
+}
+
+// Stop cancels the script, running any active finally blocks first. A paused script is resumed so it can stop.
+func (e *Execution) Stop() error {
+	return e.send(&executionCommand{
+		run: func() error {
+			e.paused = false
+			return e.script.Cancel()
+		},
+	})
+}
+
+// Variables returns the current value of all the variables in the script
+func (e *Execution) Variables() map[string]string {
+	return e.Snapshot().Variables
+}
+
+// Wait blocks until the script stops, and returns the error that stopped it (if any)
+func (e *Execution) Wait() error {
+	<-e.done
+	return e.err
+}
+
+func (e *Execution) isDone() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// loop runs the script, and then handles commands, timers and the context until the script stops.
+func (e *Execution) loop() {
+	s := e.script
+	e.lock.Lock()
+	s.StartContext(e.ctx)
+	for {
+		e.publish()
+		if s.State == ScriptStateFinished || s.State == ScriptStateFailed || s.State == ScriptStateCancelled {
+			break
+		}
+		if !e.paused && len(e.commands) == 0 {
+			if s.State == ScriptStatePaused {
+				// Carry on from where the script stopped
+				s.run()
+				continue
+			}
+			if len(e.pending) > 0 {
+				command := e.pending[0]
+				e.pending = e.pending[1:]
+				command.run()
+				continue
+			}
+		}
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if deadline, ok := s.NextDeadline(); ok && !e.paused {
+			timer = time.NewTimer(deadline.Sub(s.now()))
+			expired = timer.C
+		}
+		e.lock.Unlock()
+		e.wait(timer, expired)
+	}
+
+	if s.State == ScriptStateFailed {
+		e.err = s.err
+	}
+	s.setWake(nil)
+	s.yield = nil
+	close(e.changes)
+	close(e.done)
+	e.lock.Unlock()
+}
+
+// wait blocks until there is something to do: a command, an expired timer, a change to the pause state, or the
+// context being cancelled. It is called without the lock, and returns with it held.
+func (e *Execution) wait(timer *time.Timer, expired <-chan time.Time) {
+	if timer != nil {
+		defer timer.Stop()
+	}
+	s := e.script
+	select {
+	case command := <-e.commands:
+		e.lock.Lock()
+		e.execute(command)
+	case <-expired:
+		e.lock.Lock()
+		if s.State == ScriptStateWaiting {
+			s.Poll()
+		}
+	case <-e.wake:
+		e.lock.Lock()
+		if s.State == ScriptStateWaiting && (s.conditionsReady() || s.eventsReady()) {
+			s.Poll()
+		}
+	case <-e.ctx.Done():
+		e.lock.Lock()
+		e.paused = false
+		s.Poll()
+	}
+}
+
+// execute runs a command, unless the script is paused and the command can wait until it is resumed.
+func (e *Execution) execute(command *executionCommand) {
+	if e.paused && command.deferrable {
+		e.pending = append(e.pending, command)
+		return
+	}
+	command.run()
+}
+
+// notify wakes up the loop, so it can check whether anything has changed (e.g. a resource the script was waiting for
+// has been granted, or an event has been published).
+func (e *Execution) notify() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// publish sends the state of the script to the changes channel if it has changed.
+func (e *Execution) publish() {
+	state := e.script.State
+	if state == e.last {
+		return
+	}
+	e.last = state
+	select {
+	case e.changes <- state:
+	default:
+		// Drop the oldest change to make room
+		select {
+		case <-e.changes:
+		default:
+		}
+		e.changes <- state
+	}
+}
+
+func (e *Execution) send(command *executionCommand) error {
+	if e.isDone() {
+		return ErrScriptNotRunning
+	}
+	select {
+	case e.commands <- command:
+		return nil
+	case <-e.done:
+		return ErrScriptNotRunning
+	}
+}
+
+// yield is called by the script between every step, and lets other goroutines use the script. It returns false to
+// stop the script when it has been paused, or there are commands to handle.
+func (e *Execution) yield() bool {
+	e.publish()
+	e.lock.Unlock()
+	e.lock.Lock()
+	return !e.paused && len(e.commands) == 0
+}
@@ -0,0 +1,205 @@
+package robolang
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExecutionInput(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "waitForInput()\nsay(text='done')", &log)
+	execution, err := script.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForState(t, execution, ScriptStateWaiting)
+	if node := execution.CurrentNode(); node == nil || node.Token.Value != "waitForInput" {
+		t.Errorf("Unexpected current node: %v", node)
+	}
+	if err := execution.Input("hello"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := execution.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state := execution.State(); state != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), state.String())
+	}
+	checkLog(t, log, "wait,input:hello,done")
+	if err := execution.Input("again"); err != ErrScriptNotRunning {
+		t.Errorf("Unexpected error: expected %v, got %v", ErrScriptNotRunning, err)
+	}
+}
+
+func TestExecutionPauseAndResume(t *testing.T) {
+	var log []string
+	script := newBehaviourScript(t, "repeatUntilFail():\n  set(variable=&count, value='tick')", &log)
+	execution, err := script.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for execution.Variables()["count"] != "tick" {
+		time.Sleep(time.Millisecond)
+	}
+	if err := execution.Pause(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForState(t, execution, ScriptStatePaused)
+	node := execution.CurrentNode()
+	time.Sleep(10 * time.Millisecond)
+	if state := execution.State(); state != ScriptStatePaused {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStatePaused.String(), state.String())
+	}
+	if execution.CurrentNode() != node {
+		t.Errorf("Script continued while paused")
+	}
+	if err := execution.Resume(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForState(t, execution, ScriptStateRunning)
+	if err := execution.Stop(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := execution.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state := execution.State(); state != ScriptStateCancelled {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateCancelled.String(), state.String())
+	}
+}
+
+func TestExecutionInputWhilePaused(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "waitForInput()\nsay(text='done')", &log)
+	execution, err := script.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForState(t, execution, ScriptStateWaiting)
+	if err := execution.Pause(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := execution.Input("hello"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForState(t, execution, ScriptStatePaused)
+	if state := execution.State(); state != ScriptStatePaused {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStatePaused.String(), state.String())
+	}
+	if err := execution.Resume(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := execution.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,input:hello,done")
+}
+
+func TestExecutionStop(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "try():\n  waitForInput()\nfinally():\n  say(text='finally')", &log)
+	execution, err := script.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForState(t, execution, ScriptStateWaiting)
+	if err := execution.Pause(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := execution.Stop(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := execution.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state := execution.State(); state != ScriptStateCancelled {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateCancelled.String(), state.String())
+	}
+	checkLog(t, log, "wait,finally")
+}
+
+func TestExecutionContextCancelled(t *testing.T) {
+	var log []string
+	ctx, cancel := context.WithCancel(context.Background())
+	script := newTestScript(t, "waitForInput()", &log)
+	execution, err := script.Run(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForState(t, execution, ScriptStateWaiting)
+	cancel()
+	err = execution.Wait()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error: expected %v, got %v", context.Canceled, err)
+	}
+	if state := execution.State(); state != ScriptStateFailed {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFailed.String(), state.String())
+	}
+}
+
+func TestExecutionContextDeadlineFinally(t *testing.T) {
+	var log []string
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	script := newTestScript(t, "try():\n  waitForInput()\nfinally():\n  waitForInput()\n  say(text='finally')", &log)
+	execution, err := script.Run(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The finally block runs, but it cannot wait once the deadline has passed
+	select {
+	case <-execution.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Script did not stop at the deadline")
+	}
+	if err := execution.Wait(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	checkLog(t, log, "wait,wait")
+}
+
+func TestExecutionTimers(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "withTimeout(duration=10ms):\n  waitForInput()\nonTimeout():\n  say(text='timeout')", &log)
+	execution, err := script.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := execution.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,timeout")
+}
+
+func TestExecutionAlreadyStarted(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "say(text='hello')", &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := script.Run(context.Background()); err != ErrScriptNotRunning {
+		t.Errorf("Unexpected error: expected %v, got %v", ErrScriptNotRunning, err)
+	}
+}
+
+// waitForState reads the state changes from an execution until the script reaches a state.
+func waitForState(t *testing.T, execution *Execution, expected ScriptState) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case state, ok := <-execution.Changes():
+			if !ok {
+				t.Fatalf("Script stopped before reaching %s", expected.String())
+			}
+			if state == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s", expected.String())
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package robolang
+
+import (
+	"io/fs"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// ParseFile reads a script from disk and parses it. The path is included in every token and error.
+func ParseFile(path string) (*ParseResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFile(path, data), nil
+}
+
+// ParseFS parses every script in fsys that matches pattern (see fs.Glob for the pattern syntax).
+//
+// The scripts are parsed concurrently and a result is returned for every matching file, in the same order as the
+// matches. If a file cannot be read, the read error is added to the errors for that file.
+func ParseFS(fsys fs.FS, pattern string) ([]*ParseResult, error) {
+	paths, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*ParseResult, len(paths))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < runtime.GOMAXPROCS(0); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pos := range queue {
+				data, err := fs.ReadFile(fsys, paths[pos])
+				if err != nil {
+					results[pos] = (&ParseResult{File: paths[pos]}).addError(err)
+					continue
+				}
+				results[pos] = parseFile(paths[pos], data)
+			}
+		}()
+	}
+	for pos := range paths {
+		queue <- pos
+	}
+	close(queue)
+	wg.Wait()
+
+	return results, nil
+}
+
+func parseFile(path string, data []byte) *ParseResult {
+	parser := NewParser(string(data))
+	parser.file = path
+	return parser.Parse()
+}
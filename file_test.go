@@ -0,0 +1,86 @@
+package robolang
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "greet.robo")
+	if err := os.WriteFile(path, []byte("say(text='hello')\nclear"), 0644); err != nil {
+		t.Fatalf("Unable to write test file: %v", err)
+	}
+
+	result, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.File != path {
+		t.Errorf("Unexpected file: expected %s, got %s", path, result.File)
+	}
+	for _, tok := range result.Tokens {
+		if tok.File != path {
+			t.Errorf("Token %s is missing the file name", tok.String())
+		}
+	}
+	if len(result.Errors) != 1 {
+		t.Fatalf("Unexpected errors: expected 1, got %v", result.Errors)
+	}
+	expected := "Unexpected token '<EOF>', expected TokenOpenBracket in " + path + " at line 1, pos 5"
+	if result.Errors[0].Error() != expected {
+		t.Errorf("Unexpected error: expected [%s], got [%s]", expected, result.Errors[0].Error())
+	}
+}
+
+func TestParseFileMissing(t *testing.T) {
+	if _, err := ParseFile(filepath.Join(t.TempDir(), "missing.robo")); err == nil {
+		t.Errorf("Expected an error, not nil")
+	}
+}
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"scripts/a.robo":    {Data: []byte("clear()")},
+		"scripts/b.robo":    {Data: []byte("say(text='{&name')")},
+		"scripts/c.robo":    {Data: []byte("")},
+		"scripts/notes.txt": {Data: []byte("not a script")},
+	}
+	results, err := ParseFS(fsys, "scripts/*.robo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []struct {
+		file   string
+		nodes  int
+		errors string
+	}{
+		{"scripts/a.robo", 1, ""},
+		{"scripts/b.robo", 1, "Missing '}' in text interpolation in scripts/b.robo at line 0, pos 9"},
+		{"scripts/c.robo", 0, "scripts/c.robo: Nothing to parse"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Unexpected number of results: expected %d, got %d", len(expected), len(results))
+	}
+	for pos, test := range expected {
+		result := results[pos]
+		errs := ""
+		for _, err := range result.Errors {
+			errs += err.Error()
+		}
+		if result.File != test.file || len(result.Nodes) != test.nodes || errs != test.errors {
+			t.Errorf("Unexpected result #%d: expected [%s,%d,%s], got [%s,%d,%s]",
+				pos,
+				test.file, test.nodes, test.errors,
+				result.File, len(result.Nodes), errs)
+		}
+	}
+}
+
+func TestParseFSBadPattern(t *testing.T) {
+	if _, err := ParseFS(fstest.MapFS{}, "["); err == nil {
+		t.Errorf("Expected an error, not nil")
+	}
+}
@@ -6,12 +6,63 @@ import (
 	"sort"
 )
 
-// Function is a block of functionality that can be executed
+// Function is a block of functionality that can be executed.
+//
+// Start is called when the function is reached in the script. A function that needs to wait for something external
+// (e.g. input) calls Call.Wait before returning, and Resume is called when the script is resumed. Returning an error
+// fails the call.
 type Function interface {
+	Start(call *Call) error
+	Resume(call *Call) error
+}
+
+// CancellableFunction is a Function that needs to know when a call that is waiting is abandoned (e.g. by a timeout),
+// for example to stop a motor
+type CancellableFunction interface {
+	Function
+	Cancel(call *Call)
+}
+
+// LegacyFunction is the original form of Function, whose methods have no access to the call. Use AdaptLegacyFunction
+// to add one to a function table.
+type LegacyFunction interface {
 	Start()
 	Resume()
 }
 
+// AdaptLegacyFunction converts a LegacyFunction to a Function. A legacy function cannot wait, so the call finishes as
+// soon as Start returns.
+func AdaptLegacyFunction(fn LegacyFunction) Function {
+	return legacyFunction{fn}
+}
+
+type legacyFunction struct {
+	fn LegacyFunction
+}
+
+func (adapter legacyFunction) Start(call *Call) error {
+	adapter.fn.Start()
+	return nil
+}
+
+func (adapter legacyFunction) Resume(call *Call) error {
+	adapter.fn.Resume()
+	return nil
+}
+
+// FunctionFunc adapts an ordinary Go function to a Function that completes as soon as it is started
+type FunctionFunc func(call *Call) error
+
+// Start calls the function
+func (fn FunctionFunc) Start(call *Call) error {
+	return fn(call)
+}
+
+// Resume does nothing, as the function never waits
+func (fn FunctionFunc) Resume(call *Call) error {
+	return nil
+}
+
 // FunctionTable defines all the available functions for a block
 type FunctionTable struct {
 	Parent    *FunctionTable `json:"parent,omitempty"`
@@ -33,6 +84,9 @@ func NewFunctionTable(functions ...*FunctionDefinition) *FunctionTable {
 
 // Get attempts to retrieve a value from table
 func (table *FunctionTable) Get(name string) (*FunctionDefinition, bool) {
+	if table == nil {
+		return nil, false
+	}
 	value, exists := table.Functions[name]
 	if exists {
 		return value, true
@@ -103,12 +157,65 @@ func (vd FunctionDefinitions) Swap(i, j int) {
 
 // FunctionDefinition defines a function that can be executed in a block
 type FunctionDefinition struct {
-	Name       string   `json:"name"`
-	Definition *Node    `json:"definition,omitempty"`
-	Function   Function `json:"-"`
+	Name       string                 `json:"name"`
+	Definition *Node                  `json:"definition,omitempty"`
+	Function   Function               `json:"-"`
+	Parameters []*ParameterDefinition `json:"parameters,omitempty"`
+	Resources  []string               `json:"resources,omitempty"`
 }
 
 // NewFunction starts a new function definition
 func NewFunction(name string) *FunctionDefinition {
 	return &FunctionDefinition{Name: name}
 }
+
+// AddParameter adds a new parameter to the function
+func (function *FunctionDefinition) AddParameter(name string, units UnitFamily) *FunctionDefinition {
+	function.Parameters = append(function.Parameters, &ParameterDefinition{
+		Name:      name,
+		Units:     units,
+		UnitsText: units.String(),
+	})
+	return function
+}
+
+// UseResources declares the exclusive device resources (e.g. wheels or speaker) that the function uses, so they are
+// locked during each call
+func (function *FunctionDefinition) UseResources(resources ...string) *FunctionDefinition {
+	function.Resources = append(function.Resources, resources...)
+	return function
+}
+
+// AddOutput adds a new parameter that the function sets, which is passed as a variable (e.g. into=&name)
+func (function *FunctionDefinition) AddOutput(name string) *FunctionDefinition {
+	function.Parameters = append(function.Parameters, &ParameterDefinition{
+		Name:      name,
+		Output:    true,
+		UnitsText: UnitNone.String(),
+	})
+	return function
+}
+
+// SetFunction sets the implementation of the function
+func (function *FunctionDefinition) SetFunction(fn Function) *FunctionDefinition {
+	function.Function = fn
+	return function
+}
+
+// Parameter attempts to retrieve a parameter from the function
+func (function *FunctionDefinition) Parameter(name string) (*ParameterDefinition, bool) {
+	for _, param := range function.Parameters {
+		if param.Name == name {
+			return param, true
+		}
+	}
+	return nil, false
+}
+
+// ParameterDefinition defines an argument that can be passed to a function
+type ParameterDefinition struct {
+	Name      string     `json:"name"`
+	Output    bool       `json:"output,omitempty"`
+	Units     UnitFamily `json:"-"`
+	UnitsText string     `json:"units"`
+}
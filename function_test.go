@@ -21,6 +21,28 @@ func TestFunctionMapToJSON(t *testing.T) {
 	}
 }
 
+func TestAdaptLegacyFunction(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "beep()\nsay(text='done')", &log)
+	legacy := &legacyBeep{log: &log}
+	script.Functions.Functions["beep"] = NewFunction("beep").SetFunction(AdaptLegacyFunction(legacy))
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "beep,done")
+}
+
+type legacyBeep struct {
+	log *[]string
+}
+
+func (fn *legacyBeep) Start() {
+	*fn.log = append(*fn.log, "beep")
+}
+
+func (fn *legacyBeep) Resume() {
+}
+
 func TestFunctionMapFromJSON(t *testing.T) {
 	fm := FunctionMap{}
 	in := "[{\"name\":\"wait\"}]"
@@ -0,0 +1,125 @@
+package robolang
+
+import (
+	"sort"
+	"strconv"
+)
+
+const handlerFunction = "on"
+
+// HandlerMode defines what happens when an event handler is triggered while the script is running
+type HandlerMode int
+
+//go:generate stringer -type=HandlerMode
+
+const (
+	// HandlerModeQueue means the handler waits until the current top-level block has finished
+	HandlerModeQueue HandlerMode = iota
+
+	// HandlerModeInterrupt means the handler runs straight away, pausing any lower priority blocks
+	HandlerModeInterrupt
+)
+
+// eventHandler is an `on(event='name'):` block that runs when the host raises a matching event. For example:
+//
+//	on(event='bumper', priority=10, mode='interrupt'):
+//	  stop()
+//	  say(text='Ouch')
+type eventHandler struct {
+	event    string
+	mode     HandlerMode
+	node     *Node
+	priority int
+}
+
+func newEventHandler(node *Node) (*eventHandler, error) {
+	handler := &eventHandler{node: node}
+	for _, arg := range node.Args {
+		if len(arg.Children) != 1 || arg.Children[0].Type != NodeConstant {
+			return nil, newRuntimeError(arg, "Handler argument '%s' must be a constant", arg.Token.Value)
+		}
+		value := arg.Children[0].Token.Value
+		switch arg.Token.Value {
+		case "event":
+			handler.event = value
+		case "priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil || priority < 0 {
+				return nil, newRuntimeError(arg, "Handler priority must be a whole number of zero or more, found '%s'", value)
+			}
+			handler.priority = priority
+		case "mode":
+			switch value {
+			case "queue":
+				handler.mode = HandlerModeQueue
+			case "interrupt":
+				handler.mode = HandlerModeInterrupt
+			default:
+				return nil, newRuntimeError(arg, "Handler mode must be 'queue' or 'interrupt', found '%s'", value)
+			}
+		default:
+			return nil, newRuntimeError(arg, "Unknown handler argument '%s'", arg.Token.Value)
+		}
+	}
+	if handler.event == "" {
+		return nil, newRuntimeError(node, "Handler is missing the event argument")
+	}
+	return handler, nil
+}
+
+// Raise triggers any handlers for an event and continues executing the script. Events without a handler are ignored.
+// Handlers are only active while the script is running, so once the main sequence has finished events are rejected.
+func (s *Script) Raise(event string) error {
+	if (s.State != ScriptStateWaiting && s.State != ScriptStatePaused) || s.cancelled {
+		return ErrScriptNotRunning
+	}
+	s.raise(event)
+	return s.run()
+}
+
+// raise starts or queues the handlers for an event.
+func (s *Script) raise(event string) {
+	for _, handler := range s.handlers {
+		if handler.event != event {
+			continue
+		}
+		if handler.mode == HandlerModeInterrupt {
+			s.startHandler(handler)
+		} else {
+			s.queued = append(s.queued, handler)
+		}
+	}
+	// Higher priority handlers go first, otherwise they run in the order they were raised
+	sort.SliceStable(s.queued, func(i, j int) bool {
+		return s.queued[i].priority > s.queued[j].priority
+	})
+}
+
+// handlerRunning checks whether any event handlers are still running.
+func (s *Script) handlerRunning() bool {
+	for _, t := range s.tasks {
+		if t.handler != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// startHandler starts a handler in a new task. Handler tasks always have a higher priority than the main sequence,
+// so the main sequence is paused until all the running handlers have finished.
+func (s *Script) startHandler(handler *eventHandler) {
+	t := s.startTask(&blockFrame{nodes: handler.node.Children}, handler.priority+1)
+	t.handler = handler
+}
+
+// startQueuedHandlers starts the next handler waiting for the current top-level block to finish, or for the running
+// handlers to finish once the main sequence is done. Only one handler is started at a time, so queued handlers run
+// one after the other.
+func (s *Script) startQueuedHandlers() bool {
+	if len(s.queued) == 0 {
+		return false
+	}
+	s.startHandler(s.queued[0])
+	s.queued = s.queued[1:]
+	return true
+}
@@ -0,0 +1,121 @@
+package robolang
+
+import "testing"
+
+func TestHandlerQueue(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "on(event='button'):\n  say(text='pressed')\nwaitForInput():\n  say(text='one')\n  say(text='two')\nsay(text='three')", &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := script.Raise("button"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait")
+
+	// The handler waits for the current top-level block to finish
+	if err := script.Resume("go"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,input:go,one,two,pressed,three")
+}
+
+func TestHandlerInterrupt(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "on(event='bumper', mode='interrupt'):\n  say(text='ouch')\nwaitForInput():\n  say(text='one')\nwaitForInput():\n  say(text='two')", &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := script.Resume("a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := script.Raise("bumper"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,input:a,one,wait,ouch")
+	if err := script.Resume("b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,input:a,one,wait,ouch,input:b,two")
+	if script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), script.State.String())
+	}
+}
+
+func TestHandlerPriority(t *testing.T) {
+	var log []string
+	input := "on(event='low', priority=1, mode='interrupt'):\n  waitForInput():\n    say(text='low')\n" +
+		"on(event='high', priority=5, mode='interrupt'):\n  say(text='high')\n" +
+		"on(event='queued', priority=9):\n  say(text='queued')\n" +
+		"waitForInput():\n  say(text='main')"
+	script := newTestScript(t, input, &log)
+	script.Start()
+	script.Raise("low")
+	script.Raise("queued")
+	script.Raise("high")
+	checkLog(t, log, "wait,wait,high")
+
+	// The input goes to the handler as it has a higher priority, the main sequence carries on waiting
+	script.Resume("x")
+	checkLog(t, log, "wait,wait,high,input:x,low")
+	script.Resume("y")
+	checkLog(t, log, "wait,wait,high,input:x,low,input:y,main,queued")
+}
+
+func TestHandlerQueueAfterMain(t *testing.T) {
+	var log []string
+	input := "on(event='bumper', mode='interrupt'):\n  waitForInput():\n    say(text='bumped')\n" +
+		"on(event='button'):\n  say(text='pressed')\n" +
+		"spawn(handle=&h):\n  waitForInput()\nsay(text='done')"
+	script := newTestScript(t, input, &log)
+	script.Start()
+	checkLog(t, log, "wait,done")
+
+	// Once the main sequence has finished, queued handlers start straight away
+	if err := script.Raise("button"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,done,pressed")
+
+	// Or when the running handlers have finished
+	script.Raise("bumper")
+	script.Raise("button")
+	checkLog(t, log, "wait,done,pressed,wait")
+	script.Resume("x")
+	checkLog(t, log, "wait,done,pressed,wait,input:x,bumped,pressed")
+	script.Resume("y")
+	checkLog(t, log, "wait,done,pressed,wait,input:x,bumped,pressed,input:y")
+	if script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), script.State.String())
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"on():\n  clear()", "Handler is missing the event argument at line 0, pos 0"},
+		{"on(event='a', mode='later'):\n  clear()", "Handler mode must be 'queue' or 'interrupt', found 'later' at line 0, pos 14"},
+		{"on(event='a', priority='high'):\n  clear()", "Handler priority must be a whole number of zero or more, found 'high' at line 0, pos 14"},
+		{"on(event=&name):\n  clear()", "Handler argument 'event' must be a constant at line 0, pos 3"},
+		{"on(event='a', when=1):\n  clear()", "Unknown handler argument 'when' at line 0, pos 14"},
+	}
+	for _, test := range tests {
+		var log []string
+		err := newTestScript(t, test.input, &log).Start()
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Unexpected error for `%s`: expected [%s], got [%v]", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestHandlerAfterFinish(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "on(event='button'):\n  say(text='pressed')\nsay(text='done')", &log)
+	script.Start()
+	if err := script.Raise("button"); err != ErrScriptNotRunning {
+		t.Errorf("Unexpected error: expected %v, got %v", ErrScriptNotRunning, err)
+	}
+	checkLog(t, log, "done")
+}
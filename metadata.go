@@ -0,0 +1,96 @@
+package robolang
+
+import "strings"
+
+// Metadata describes a script. It is declared in a header at the top of the script, either on its own:
+//
+//	script(name='Patrol', version='1.2')
+//
+// or as a block containing the rest of the script:
+//
+//	script(name='Patrol', version='1.2'):
+//	  say(text='Starting patrol')
+type Metadata struct {
+	Author          string            `json:"author,omitempty"`
+	Capabilities    []string          `json:"capabilities,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	LanguageVersion string            `json:"language,omitempty"`
+	Name            string            `json:"name,omitempty"`
+	Node            *Node             `json:"-"`
+	Profile         string            `json:"profile,omitempty"`
+	Properties      map[string]string `json:"properties,omitempty"`
+	Version         string            `json:"version,omitempty"`
+}
+
+// HasCapability checks whether the script requires a capability
+func (meta *Metadata) HasCapability(name string) bool {
+	for _, capability := range meta.Capabilities {
+		if capability == name {
+			return true
+		}
+	}
+	return false
+}
+
+const headerFunction = "script"
+
+// extractMetadata removes the script header from the nodes and converts it to metadata.
+func (result *ParseResult) extractMetadata() {
+	for pos, node := range result.Nodes {
+		if node.Type == NodeFunction && node.Token.Value == headerFunction && pos > 0 {
+			result.addError(newParseError(node.Token, "The script header must be the first statement"))
+		}
+	}
+	if len(result.Nodes) == 0 || result.Nodes[0].Type != NodeFunction || result.Nodes[0].Token.Value != headerFunction {
+		return
+	}
+
+	header := result.Nodes[0]
+	result.useFeature(FeatureScriptHeader, header.Token)
+	meta := &Metadata{Node: header}
+	for _, arg := range header.Args {
+		if len(arg.Children) != 1 || arg.Children[0].Type != NodeConstant {
+			result.addError(newParseError(arg.Token, "Script header value '%s' must be a constant", arg.Token.Value))
+			continue
+		}
+
+		value := arg.Children[0].Token.Value
+		switch arg.Token.Value {
+		case "author":
+			meta.Author = value
+		case "capabilities":
+			for _, capability := range strings.Split(value, ",") {
+				if capability = strings.TrimSpace(capability); capability != "" {
+					meta.Capabilities = append(meta.Capabilities, capability)
+				}
+			}
+		case "description":
+			meta.Description = value
+		case "language":
+			meta.LanguageVersion = value
+		case "name":
+			meta.Name = value
+		case "profile":
+			meta.Profile = value
+		case "version":
+			meta.Version = value
+		default:
+			if meta.Properties == nil {
+				meta.Properties = map[string]string{}
+			}
+			meta.Properties[arg.Token.Value] = value
+		}
+	}
+
+	result.Metadata = meta
+	result.Nodes = append(append([]*Node{}, header.Children...), result.Nodes[1:]...)
+
+	// The hoisted children are now top level nodes, and the header only covers its own line
+	children := header.Children
+	for _, child := range children {
+		child.updateRange(nil)
+	}
+	header.Children = nil
+	header.updateRange(nil)
+	header.Children = children
+}
@@ -0,0 +1,100 @@
+package robolang
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		nodes    string
+	}{
+		{"clear()", "null", "NodeFunction:clear"},
+		{
+			"script(name='Patrol', version='1.2', author='Sam', language='1.1')\nclear()",
+			`{"author":"Sam","language":"1.1","name":"Patrol","version":"1.2"}`,
+			"NodeFunction:clear",
+		},
+		{
+			"script(name='Greeter', profile='lobby', capabilities='speech, display', room=4):\n  say(text='hi')\n  clear()",
+			`{"capabilities":["speech","display"],"name":"Greeter","profile":"lobby","properties":{"room":"4"}}`,
+			"NodeFunction:say(NodeArgument:text->(NodeConstant:hi))\nNodeFunction:clear",
+		},
+	}
+	for _, test := range tests {
+		result := NewParser(test.input).Parse()
+		if len(result.Errors) > 0 {
+			t.Errorf("Unexpected errors while parsing `%s`: [%v]", test.input, result.Errors)
+			continue
+		}
+		data, _ := json.Marshal(result.Metadata)
+		if string(data) != test.expected {
+			t.Errorf("Unexpected metadata for `%s`: expected %s, got %s", test.input, test.expected, data)
+		}
+		if nodes := nodesString(result.Nodes); nodes != test.nodes {
+			t.Errorf("Unexpected nodes for `%s`: expected [%s], got [%s]", test.input, test.nodes, nodes)
+		}
+		if source := result.SyntaxTree().String(); source != test.input {
+			t.Errorf("Syntax tree does not round trip: expected %q, got %q", test.input, source)
+		}
+	}
+}
+
+func TestMetadataNodes(t *testing.T) {
+	input := "script(name='Greeter'):\n  say(text='hi')\nclear()"
+	result := NewParser(input).Parse()
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors while parsing `%s`: [%v]", input, result.Errors)
+	}
+
+	header, say, clear := result.Metadata.Node, result.Nodes[0], result.Nodes[1]
+	if say.Parent != nil || clear.Parent != nil {
+		t.Errorf("Hoisted nodes should not have a parent")
+	}
+	if header.Start != (Position{0, 0}) || header.End != (Position{0, 21}) {
+		t.Errorf("Unexpected range for header: [%v-%v]", header.Start, header.End)
+	}
+
+	lookups := []struct {
+		lineNum  int
+		linePos  int
+		expected *Node
+	}{
+		{0, 3, header},
+		{0, 10, header.Args[0]},
+		{1, 3, say},
+		{1, 0, nil},
+		{2, 1, clear},
+	}
+	for _, lookup := range lookups {
+		actual := result.NodeAt(lookup.lineNum, lookup.linePos)
+		if actual != lookup.expected {
+			t.Errorf("Unexpected node at [%d,%d]: expected %v, got %v", lookup.lineNum, lookup.linePos, lookup.expected, actual)
+		}
+	}
+}
+
+func TestParseMetadataErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"clear()\nscript(name='Late')", "The script header must be the first statement at line 1, pos 0"},
+		{"script(name='Hi {&name}')", "Script header value 'name' must be a constant at line 0, pos 7"},
+	}
+	for _, test := range tests {
+		result := NewParser(test.input).Parse()
+		if len(result.Errors) != 1 || result.Errors[0].Error() != test.expected {
+			t.Errorf("Unexpected errors for `%s`: expected [%s], got %v", test.input, test.expected, result.Errors)
+		}
+	}
+}
+
+func TestMetadataHasCapability(t *testing.T) {
+	meta := &Metadata{Capabilities: []string{"speech"}}
+	if !meta.HasCapability("speech") || meta.HasCapability("motion") {
+		t.Errorf("Unexpected capabilities: %v", meta.Capabilities)
+	}
+}
@@ -6,11 +6,18 @@ import (
 
 // Node is a node in the AST
 type Node struct {
-	Args     []*Node  `json:"args,omitempty"`
-	Children []*Node  `json:"children,omitempty"`
-	Token    *Token   `json:"token"`
-	Type     NodeType `json:"-"`
-	TypeText string   `json:"type"`
+	Args     []*Node   `json:"args,omitempty"`
+	Children []*Node   `json:"children,omitempty"`
+	Doc      string    `json:"doc,omitempty"`
+	End      Position  `json:"end"`
+	Parent   *Node     `json:"-"`
+	Quantity *Quantity `json:"quantity,omitempty"`
+	Start    Position  `json:"start"`
+	Token    *Token    `json:"token"`
+	Type     NodeType  `json:"-"`
+	TypeText string    `json:"type"`
+
+	last *Token
 }
 
 // String converts the node to a human-readable form.
@@ -42,16 +49,75 @@ func (n *Node) String() string {
 
 // AddArgument adds a new argument to the node
 func (n *Node) AddArgument(arg *Node) *Node {
+	arg.Parent = n
 	n.Args = append(n.Args, arg)
 	return n
 }
 
 // AddChild adds a new child to the node
 func (n *Node) AddChild(arg *Node) *Node {
+	arg.Parent = n
 	n.Children = append(n.Children, arg)
 	return n
 }
 
+// Contains checks whether a source location is within the node
+func (n *Node) Contains(at Position) bool {
+	return !at.Before(n.Start) && at.Before(n.End)
+}
+
+func (n *Node) nodeAt(at Position) *Node {
+	if !n.Contains(at) {
+		return nil
+	}
+	for _, nodes := range [][]*Node{n.Args, n.Children} {
+		for _, child := range nodes {
+			if found := child.nodeAt(at); found != nil {
+				return found
+			}
+		}
+	}
+	return n
+}
+
+// updateRange sets the parent and the full source range of the node and all its descendants.
+func (n *Node) updateRange(parent *Node) {
+	n.Parent = parent
+	if n.Token == nil {
+		return
+	}
+
+	n.Start, n.End = n.Token.Start(), n.Token.End()
+	if n.last != nil && n.last.Type != TokenNewLine && n.End.Before(n.last.End()) {
+		n.End = n.last.End()
+	}
+	for _, nodes := range [][]*Node{n.Args, n.Children} {
+		for _, child := range nodes {
+			child.updateRange(n)
+			if child.Token == nil {
+				continue
+			}
+			if child.Start.Before(n.Start) {
+				n.Start = child.Start
+			}
+			if n.End.Before(child.End) {
+				n.End = child.End
+			}
+		}
+	}
+}
+
+// Position is a location in the source
+type Position struct {
+	LineNum int `json:"lineNum"`
+	LinePos int `json:"linePos"`
+}
+
+// Before checks whether this position comes before another position
+func (pos Position) Before(other Position) bool {
+	return pos.LineNum < other.LineNum || (pos.LineNum == other.LineNum && pos.LinePos < other.LinePos)
+}
+
 // NodeType defines the type of node
 type NodeType int
 
@@ -75,4 +141,7 @@ const (
 
 	// NodeVariable means this node points to a variable
 	NodeVariable
+
+	// NodeTemplate means this node is text with interpolated values
+	NodeTemplate
 )
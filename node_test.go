@@ -49,6 +49,16 @@ func TestNodeStringWithChildren(t *testing.T) {
 	}
 }
 
+func TestNodeParent(t *testing.T) {
+	arg, child := makeNode(NodeArgument, TokenIdentifier, "value"), makeNode(NodeFunction, TokenIdentifier, "child")
+	node := makeNode(NodeFunction, TokenIdentifier, "test").
+		AddArgument(arg).
+		AddChild(child)
+	if arg.Parent != node || child.Parent != node {
+		t.Errorf("Node parent has not been set")
+	}
+}
+
 func makeNode(nodeType NodeType, tokenType TokenType, value string) *Node {
 	return &Node{
 		Type:  nodeType,
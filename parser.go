@@ -2,37 +2,76 @@ package robolang
 
 import (
 	"fmt"
+	"strings"
 )
 
 // Parser converts a stream of input into an Abstract Syntax Tree (AST).
 type Parser struct {
-	Log func(string, ...interface{})
-
+	Limits Limits
+	Log    func(string, ...interface{})
+
+	brackets       int
+	depth          int
+	file           string
+	limitErr       error
+	started        bool
 	functionArgMap map[TokenType]func() (*Node, error)
 	result         *ParseResult
 	s              *Scanner
+	size           int
+	tokenCount     int
 	buf            struct {
 		token *Token
 		n     int
 	}
+	doc struct {
+		lines   []string
+		token   *Token
+		text    string
+		newLine bool
+		code    bool
+	}
 }
 
 var (
 	skipTokens = map[TokenType]bool{
 		TokenWhitespace: true,
 		TokenComment:    true,
+		TokenDirective:  true,
 	}
 )
 
+// Limits restricts the resources a parser can use, so untrusted scripts cannot exhaust the stack or memory. A limit
+// of zero means there is no limit.
+type Limits struct {
+	MaxArgs       int
+	MaxDepth      int
+	MaxSourceSize int
+	MaxTextLength int
+	MaxTokens     int
+}
+
+// DefaultLimits are the limits for a new parser, these are safe to use for untrusted scripts.
+var DefaultLimits = Limits{
+	MaxArgs:       64,
+	MaxDepth:      64,
+	MaxSourceSize: 1 << 20,
+	MaxTextLength: 64 << 10,
+	MaxTokens:     200000,
+}
+
 // NewParser builds a new parser instance.
 func NewParser(s string) *Parser {
 	p := &Parser{
-		s:   NewScanner(s),
-		Log: func(string, ...interface{}) {},
+		s:      NewScanner(s),
+		size:   len(s),
+		Limits: DefaultLimits,
+		Log:    func(string, ...interface{}) {},
 	}
 	p.functionArgMap = map[TokenType]func() (*Node, error){
 		TokenDuration: p.parseConstant,
 		TokenNumber:   p.parseConstant,
+		TokenQuantity: p.parseConstant,
 		TokenResource: p.parseResource,
 		TokenText:     p.parseConstant,
 		TokenVariable: p.parseVariable,
@@ -47,30 +86,19 @@ func (p *Parser) Parse() *ParseResult {
 		return p.result
 	}
 
-	p.result = &ParseResult{}
-	tok := p.scanNextToken()
-	if tok.Type == TokenEOF {
-		return p.result.addErrorf("Nothing to parse")
+	p.result = &ParseResult{File: p.file}
+	p.parseNodes()
+	for _, node := range p.result.Nodes {
+		node.updateRange(nil)
 	}
-
-	for ; tok.Type != TokenEOF; tok = p.scanNextToken() {
-		if tok.Type != TokenNewLine {
-			p.unscan()
-			node, err := p.parseItem()
-			if node != nil {
-				p.result.addNode(node)
-			}
-			if err != nil {
-				return p.result.addError(err)
-			}
-		}
-	}
-
+	p.result.extractMetadata()
+	p.result.checkFeatures()
 	return p.result
 }
 
 func (p *Parser) clearToNewLine() {
 	p.Log("Clearing to newline")
+	p.brackets = 0
 	for tok := p.scanNextToken(); tok.Type != TokenEOF && tok.Type != TokenNewLine; tok = p.scanNextToken() {
 	}
 	p.unscan()
@@ -81,6 +109,7 @@ func (p *Parser) makeNode(tok *Token, tokenType NodeType) *Node {
 		Token:    tok,
 		Type:     tokenType,
 		TypeText: tokenType.String(),
+		last:     tok,
 	}
 }
 
@@ -98,7 +127,25 @@ func (p *Parser) makeUnexpectedError(tok *Token, expected string) error {
 func (p *Parser) parseConstant() (*Node, error) {
 	tok := p.scanNextToken()
 	p.Log("parsing constant %s", tok.Value)
-	return p.makeNode(tok, NodeConstant), nil
+	if tok.Type == TokenText && strings.ContainsAny(tok.Value, "{}") {
+		return p.parseTemplate(tok)
+	}
+
+	node := p.makeNode(tok, NodeConstant)
+	if tok.Type == TokenQuantity {
+		p.result.useFeature(FeatureQuantities, tok)
+	}
+	if tok.Type == TokenText && strings.HasPrefix(tok.Source, "'''") {
+		p.result.useFeature(FeatureMultiLineText, tok)
+	}
+	if tok.Type == TokenQuantity || tok.Type == TokenDuration {
+		quantity, err := Units.Parse(tok.Value)
+		if err != nil {
+			return node, newParseError(tok, "%v", err)
+		}
+		node.Quantity = quantity
+	}
+	return node, nil
 }
 
 func (p *Parser) parseFunction() (*Node, error) {
@@ -109,11 +156,24 @@ func (p *Parser) parseFunction() (*Node, error) {
 	}
 
 	node := p.makeNode(tok, NodeFunction)
+	if p.doc.token == tok {
+		node.Doc = p.doc.text
+	}
+	if feature, ok := functionFeatures[tok.Value]; ok {
+		p.result.useFeature(feature, tok)
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.Limits.MaxDepth > 0 && p.depth > p.Limits.MaxDepth {
+		return node, newParseError(tok, "Blocks are nested too deeply (limit is %d)", p.Limits.MaxDepth)
+	}
 	p.Log("parsing function %s", tok.Value)
 	if err := p.validateNextToken(TokenOpenBracket); err != nil {
 		return node, err
 	}
 
+	// New lines are allowed anywhere between the brackets
+	p.brackets++
 	for tok = p.scanNextToken(); tok.Type != TokenCloseBracket; {
 		p.unscan()
 		arg, err := p.parseFunctionArg()
@@ -122,21 +182,32 @@ func (p *Parser) parseFunction() (*Node, error) {
 		}
 
 		node.AddArgument(arg)
+		if p.Limits.MaxArgs > 0 && len(node.Args) > p.Limits.MaxArgs {
+			return node, newParseError(arg.Token, "Too many arguments for %s (limit is %d)", node.Token.Value, p.Limits.MaxArgs)
+		}
 		tok = p.scanNextToken()
 		if tok.Type == TokenComma {
-			tok = p.scanNextToken()
+			comma := tok
+			if tok = p.scanNextToken(); tok.Type == TokenCloseBracket {
+				p.result.useFeature(FeatureTrailingComma, comma)
+			}
 		}
 	}
+	p.brackets--
+	node.last = tok
 
 	tok = p.scanNextToken()
 	if tok.Type != TokenColon {
 		p.unscan()
 		return node, nil
 	}
+	node.last = tok
 
-	if err := p.validateNextToken(TokenNewLine); err != nil {
+	tok = p.scanNextToken()
+	if err := p.validateToken(tok, TokenNewLine); err != nil {
 		return node, err
 	}
+	node.last = tok
 
 	cont := true
 	tok = p.scan()
@@ -206,12 +277,105 @@ func (p *Parser) parseItem() (*Node, error) {
 	return p.makeNode(tok, NodeInvalid), p.makeUnexpectedError(tok, "")
 }
 
+func (p *Parser) parseNodes() {
+	if p.Limits.MaxSourceSize > 0 && p.size > p.Limits.MaxSourceSize {
+		p.result.addErrorf("Script is too large (%d bytes, limit is %d)", p.size, p.Limits.MaxSourceSize)
+		return
+	}
+
+	tok := p.scanNextToken()
+	if tok.Type == TokenEOF && p.limitErr == nil {
+		p.result.addErrorf("Nothing to parse")
+		return
+	}
+
+	for ; tok.Type != TokenEOF; tok = p.scanNextToken() {
+		if tok.Type != TokenNewLine {
+			p.unscan()
+			node, err := p.parseItem()
+			if node != nil {
+				p.result.addNode(node)
+			}
+			if err != nil {
+				p.scanToEnd()
+				if p.limitErr != nil {
+					// Any other error is a side effect of the parser stopping early
+					err = p.limitErr
+				}
+				p.result.addError(err)
+				return
+			}
+		}
+	}
+	if p.limitErr != nil {
+		p.result.addError(p.limitErr)
+	}
+}
+
 func (p *Parser) parseResource() (*Node, error) {
 	tok := p.scanNextToken()
 	p.Log("parsing resource %s", tok.Value)
 	return p.makeNode(tok, NodeResource), nil
 }
 
+func (p *Parser) parseTemplate(tok *Token) (*Node, error) {
+	p.Log("parsing template %s", tok.Value)
+	p.result.useFeature(FeatureTemplates, tok)
+	if strings.HasPrefix(tok.Source, "'''") {
+		p.result.useFeature(FeatureMultiLineText, tok)
+	}
+	node := p.makeNode(tok, NodeTemplate)
+	segment := func(tokenType TokenType, nodeType NodeType, value string, offset int) {
+		lineNum, linePos := tok.ValuePosition(offset)
+		node.AddChild(p.makeNode(&Token{
+			File:     tok.File,
+			Type:     tokenType,
+			TypeName: tokenType.String(),
+			Value:    value,
+			LineNum:  lineNum,
+			LinePos:  linePos,
+		}, nodeType))
+	}
+
+	var buf strings.Builder
+	start, value := 0, tok.Value
+	for pos := 0; pos < len(value); pos++ {
+		ch := value[pos]
+		if (ch == '{' || ch == '}') && pos+1 < len(value) && value[pos+1] == ch {
+			buf.WriteByte(ch)
+			pos++
+			continue
+		}
+		if ch == '}' {
+			return node, newParseError(tok, "Unexpected '}' in text, use '}}' for a literal brace")
+		}
+		if ch != '{' {
+			buf.WriteByte(ch)
+			continue
+		}
+
+		end := strings.IndexByte(value[pos:], '}')
+		if end < 0 {
+			return node, newParseError(tok, "Missing '}' in text interpolation")
+		}
+		name := strings.TrimSpace(value[pos+1 : pos+end])
+		if !strings.HasPrefix(name, "&") || !isTemplateName(name[1:]) {
+			return node, newParseError(tok, "Invalid text interpolation '{%s}', expected a variable", name)
+		}
+		if buf.Len() > 0 {
+			segment(TokenText, NodeConstant, buf.String(), start)
+			buf.Reset()
+		}
+		segment(TokenVariable, NodeVariable, name[1:], pos)
+		pos += end
+		start = pos + 1
+	}
+	if buf.Len() > 0 {
+		segment(TokenText, NodeConstant, buf.String(), start)
+	}
+	return node, nil
+}
+
 func (p *Parser) parseVariable() (*Node, error) {
 	tok := p.scanNextToken()
 	p.Log("parsing variable %s", tok.Value)
@@ -224,18 +388,52 @@ func (p *Parser) scan() *Token {
 		return p.buf.token
 	}
 
+	if p.limitErr != nil {
+		return p.buf.token
+	}
+
 	token := p.s.Scan()
+	token.File = p.file
+	if err := p.checkTokenLimits(token); err != nil {
+		// Stop parsing by pretending the input has finished
+		p.limitErr = err
+		token = &Token{File: p.file, LineNum: token.LineNum, LinePos: token.LinePos, Type: TokenEOF, TypeName: TokenEOF.String()}
+		p.buf.token = token
+		return token
+	}
 	p.buf.token = token
 	p.result.addToken(token)
+	p.trackDoc(token)
+	p.trackDirective(token)
 	return token
 }
 
+func (p *Parser) checkTokenLimits(token *Token) error {
+	p.tokenCount++
+	if p.Limits.MaxTokens > 0 && p.tokenCount > p.Limits.MaxTokens {
+		return newParseError(token, "Too many tokens (limit is %d)", p.Limits.MaxTokens)
+	}
+	if p.Limits.MaxTextLength > 0 && token.Type == TokenText && len(token.Value) > p.Limits.MaxTextLength {
+		return newParseError(token, "Text is too long (%d characters, limit is %d)", len(token.Value), p.Limits.MaxTextLength)
+	}
+	return nil
+}
+
+// scanToEnd reads the rest of the input so the result contains every token in the source.
+func (p *Parser) scanToEnd() {
+	for tok := p.scan(); tok.Type != TokenEOF; tok = p.scan() {
+	}
+}
+
 func (p *Parser) scanNextToken() *Token {
 	token := p.scan()
 	for {
-		if !skipTokens[token.Type] {
+		if !skipTokens[token.Type] && (p.brackets == 0 || token.Type != TokenNewLine) {
 			break
 		}
+		if token.Type == TokenNewLine {
+			p.result.useFeature(FeatureMultiLineArgs, token)
+		}
 		token = p.scan()
 	}
 
@@ -243,6 +441,30 @@ func (p *Parser) scanNextToken() *Token {
 	return token
 }
 
+// trackDoc collects doc comments (##) so they can be attached to the node that directly follows them.
+func (p *Parser) trackDoc(token *Token) {
+	switch token.Type {
+	case TokenWhitespace:
+	case TokenComment:
+		if p.doc.code {
+			break
+		}
+		if strings.HasPrefix(token.Value, "#") {
+			p.doc.lines = append(p.doc.lines, strings.TrimPrefix(token.Value[1:], " "))
+		}
+		p.doc.newLine = false
+	case TokenNewLine:
+		if p.doc.newLine {
+			// A blank line separates the doc comment from whatever follows
+			p.doc.lines = nil
+		}
+		p.doc.newLine, p.doc.code = true, false
+	default:
+		p.doc.token, p.doc.text = token, strings.Join(p.doc.lines, "\n")
+		p.doc.lines, p.doc.newLine, p.doc.code = nil, false, true
+	}
+}
+
 func (p *Parser) unscan() {
 	p.buf.n = 1
 }
@@ -260,11 +482,54 @@ func (p *Parser) validateToken(tok *Token, expected TokenType) error {
 	return nil
 }
 
+func isTemplateName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if part == "" {
+			return false
+		}
+		for _, ch := range part {
+			if !(ch >= 'a' && ch <= 'z') && !(ch >= 'A' && ch <= 'Z') && !(ch >= '0' && ch <= '9') && ch != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // ParseResult is generated from the parser after.
 type ParseResult struct {
-	Errors []error
-	Nodes  []*Node
-	Tokens []*Token
+	Errors          []error
+	File            string
+	LanguageVersion Version
+	Metadata        *Metadata
+	Nodes           []*Node
+	Tokens          []*Token
+
+	features map[string]*Token
+}
+
+// SyntaxTree converts the parse result to a lossless syntax tree
+func (result *ParseResult) SyntaxTree() *SyntaxTree {
+	nodes := result.Nodes
+	if header := result.Metadata; header != nil {
+		// The header's children (if any) come first in the nodes
+		nodes = append([]*Node{header.Node}, result.Nodes[len(header.Node.Children):]...)
+	}
+	return newSyntaxTree(nodes, result.Tokens)
+}
+
+// NodeAt finds the innermost node that covers a source location
+func (result *ParseResult) NodeAt(lineNum, linePos int) *Node {
+	at := Position{LineNum: lineNum, LinePos: linePos}
+	for _, node := range result.Nodes {
+		if found := node.nodeAt(at); found != nil {
+			return found
+		}
+	}
+	if result.Metadata != nil {
+		return result.Metadata.Node.nodeAt(at)
+	}
+	return nil
 }
 
 // Script converts the parse result to an executable script
@@ -280,6 +545,9 @@ func (result *ParseResult) addError(err error) *ParseResult {
 }
 
 func (result *ParseResult) addErrorf(format string, a ...interface{}) *ParseResult {
+	if result.File != "" {
+		return result.addError(fmt.Errorf("%s: %s", result.File, fmt.Sprintf(format, a...)))
+	}
 	return result.addError(fmt.Errorf(format, a...))
 }
 
@@ -295,6 +563,7 @@ func (result *ParseResult) addToken(token *Token) *ParseResult {
 
 // ParseError provides a consistent format for reporting parse errors
 type ParseError struct {
+	File         string
 	Message      string
 	LineNumber   int
 	LinePosition int
@@ -302,11 +571,15 @@ type ParseError struct {
 
 // Error converts this struct into an error message
 func (err *ParseError) Error() string {
+	if err.File != "" {
+		return fmt.Sprintf("%s in %s at line %d, pos %d", err.Message, err.File, err.LineNumber, err.LinePosition)
+	}
 	return fmt.Sprintf("%s at line %d, pos %d", err.Message, err.LineNumber, err.LinePosition)
 }
 
 func newParseError(tok *Token, format string, a ...interface{}) error {
 	return &ParseError{
+		File:         tok.File,
 		Message:      fmt.Sprintf(format, a...),
 		LineNumber:   tok.LineNum,
 		LinePosition: tok.LinePos,
@@ -39,10 +39,16 @@ func TestParseFromString(t *testing.T) {
 		{"show(resource=@hello)", "NodeFunction:show(NodeArgument:resource->(NodeResource:hello))"},
 		{"set(variable=&count,value=1)", "NodeFunction:set(NodeArgument:variable->(NodeVariable:count),NodeArgument:value->(NodeConstant:1))"},
 		{"waitForTime(duration=5m)", "NodeFunction:waitForTime(NodeArgument:duration->(NodeConstant:5m))"},
+		{"move(distance=30cm)", "NodeFunction:move(NodeArgument:distance->(NodeConstant:30cm))"},
+		{"say(text='Hi {&name}!')", "NodeFunction:say(NodeArgument:text->(NodeTemplate:Hi {&name}!->(NodeConstant:Hi ,NodeVariable:name,NodeConstant:!)))"},
+		{"say(text='{{&name}}')", "NodeFunction:say(NodeArgument:text->(NodeTemplate:{{&name}}->(NodeConstant:{&name})))"},
 		{"waitForInput():\n  clear()", "NodeFunction:waitForInput->(NodeFunction:clear)"},
 		{"clear()\nsay(text=@hello)", "NodeFunction:clear\nNodeFunction:say(NodeArgument:text->(NodeResource:hello))"},
 		{"waitForInput():\n  clear()\n  say(text=@hello)", "NodeFunction:waitForInput->(NodeFunction:clear,NodeFunction:say(NodeArgument:text->(NodeResource:hello)))"},
 		{"waitForInput():\n  #clear()\n  say(text=@hello)", "NodeFunction:waitForInput->(NodeFunction:say(NodeArgument:text->(NodeResource:hello)))"},
+		{"set(variable=&count,value=1,)", "NodeFunction:set(NodeArgument:variable->(NodeVariable:count),NodeArgument:value->(NodeConstant:1))"},
+		{"set(\n  variable=&count,\n  value=1,\n)\nclear()", "NodeFunction:set(NodeArgument:variable->(NodeVariable:count),NodeArgument:value->(NodeConstant:1))\nNodeFunction:clear"},
+		{"waitForInput():\n  say(\n    text='''\n      Hello\n      world\n    ''')\n  clear()", "NodeFunction:waitForInput->(NodeFunction:say(NodeArgument:text->(NodeConstant:Hello\nworld)),NodeFunction:clear)"},
 	}
 	for _, test := range tests {
 		t.Logf("==== Parsing `%s` ====", test.input)
@@ -61,6 +67,9 @@ func TestParseErrors(t *testing.T) {
 		{"clear", "Unexpected token '<EOF>', expected TokenOpenBracket"},
 		{"clear(", "Unexpected token '<EOF>', expected TokenCloseBracket or TokenIdentifier"},
 		{"clear--", "Unexpected token '-', expected TokenOpenBracket"},
+		{"say(text='Hi {&name')", "Missing '}' in text interpolation"},
+		{"say(text='Hi {name}')", "Invalid text interpolation '{name}', expected a variable"},
+		{"say(text='Hi }')", "Unexpected '}' in text, use '}}' for a literal brace"},
 	}
 	for _, test := range tests {
 		t.Logf("==== Parsing `%s` ====", test.input)
@@ -84,6 +93,189 @@ func TestParseErrors(t *testing.T) {
 	}
 }
 
+func TestParseQuantities(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"move(distance=30cm)", "30cm"},
+		{"turn(angle=90deg)", "90deg"},
+		{"setVolume(level=40%)", "40%"},
+		{"drive(speed=36kph)", "10mps"},
+		{"waitForTime(duration=1m30s)", "90s"},
+		{"waitForTime(duration=250ms)", "0.25s"},
+	}
+	for _, test := range tests {
+		parser := NewParser(test.input)
+		result := parser.Parse()
+		if len(result.Errors) > 0 {
+			t.Errorf("Unexpected errors while parsing `%s`: [%v]", test.input, result.Errors)
+			continue
+		}
+		quantity := result.Nodes[0].Args[0].Children[0].Quantity
+		if quantity == nil {
+			t.Errorf("Missing quantity for `%s`", test.input)
+		} else if quantity.String() != test.expected {
+			t.Errorf("Unexpected quantity for `%s`: expected [%s], got [%s]", test.input, test.expected, quantity.String())
+		}
+	}
+}
+
+func TestParseMultiLineLocations(t *testing.T) {
+	input := "say(\n  text='''\n    Hi {&name}\n  ''',\n)\nclear()"
+	result := NewParser(input).Parse()
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors while parsing `%s`: [%v]", input, result.Errors)
+	}
+
+	variable := result.Nodes[0].Args[0].Children[0].Children[1]
+	if variable.Token.LineNum != 2 || variable.Token.LinePos != 7 {
+		t.Errorf("Unexpected location for variable: expected [2,7], got [%d,%d]", variable.Token.LineNum, variable.Token.LinePos)
+	}
+	clear := result.Nodes[1]
+	if clear.Token.LineNum != 5 || clear.Token.LinePos != 0 {
+		t.Errorf("Unexpected location for clear: expected [5,0], got [%d,%d]", clear.Token.LineNum, clear.Token.LinePos)
+	}
+}
+
+func TestParseDocComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"## Clears the screen\nclear()", []string{"Clears the screen"}},
+		{"## First line\n##\n## Third line\nclear()", []string{"First line\n\nThird line"}},
+		{"## Greeting\n# ordinary comment\nsay(text='hi')", []string{"Greeting"}},
+		{"# ordinary comment\nclear()", []string{""}},
+		{"## Detached\n\nclear()", []string{""}},
+		{"clear() ## trailing\nsay(text='hi')", []string{"", ""}},
+		{"## Waits\nwaitForInput():\n  ## Child\n  clear()", []string{"Waits", "Child"}},
+	}
+	for _, test := range tests {
+		result := NewParser(test.input).Parse()
+		if len(result.Errors) > 0 {
+			t.Errorf("Unexpected errors while parsing `%s`: [%v]", test.input, result.Errors)
+			continue
+		}
+
+		var actual []string
+		var collect func(nodes []*Node)
+		collect = func(nodes []*Node) {
+			for _, node := range nodes {
+				actual = append(actual, node.Doc)
+				collect(node.Children)
+			}
+		}
+		collect(result.Nodes)
+		if strings.Join(actual, "|") != strings.Join(test.expected, "|") {
+			t.Errorf("Unexpected docs for `%s`: expected %q, got %q", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	input := "waitForInput():\n  say(\n    text='hi',\n  )\n  clear()\nstop()"
+	result := NewParser(input).Parse()
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors while parsing `%s`: [%v]", input, result.Errors)
+	}
+
+	wait, stop := result.Nodes[0], result.Nodes[1]
+	say, clear := wait.Children[0], wait.Children[1]
+	tests := []struct {
+		node  *Node
+		start Position
+		end   Position
+	}{
+		{wait, Position{0, 0}, Position{4, 9}},
+		{say, Position{1, 2}, Position{3, 3}},
+		{say.Args[0], Position{2, 4}, Position{2, 13}},
+		{clear, Position{4, 2}, Position{4, 9}},
+		{stop, Position{5, 0}, Position{5, 6}},
+	}
+	for _, test := range tests {
+		if test.node.Start != test.start || test.node.End != test.end {
+			t.Errorf("Unexpected range for %s: expected [%v-%v], got [%v-%v]",
+				test.node.Token.Value,
+				test.start, test.end,
+				test.node.Start, test.node.End)
+		}
+	}
+
+	if say.Parent != wait || say.Args[0].Parent != say || wait.Parent != nil {
+		t.Errorf("Node parents have not been set")
+	}
+
+	lookups := []struct {
+		lineNum  int
+		linePos  int
+		expected *Node
+	}{
+		{0, 3, wait},
+		{2, 10, say.Args[0].Children[0]},
+		{3, 2, say},
+		{4, 0, wait},
+		{5, 5, stop},
+		{5, 6, nil},
+		{9, 0, nil},
+	}
+	for _, lookup := range lookups {
+		actual := result.NodeAt(lookup.lineNum, lookup.linePos)
+		if actual != lookup.expected {
+			t.Errorf("Unexpected node at [%d,%d]: expected %v, got %v", lookup.lineNum, lookup.linePos, lookup.expected, actual)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	nested := "a():\n"
+	for depth := 1; depth < 5; depth++ {
+		nested += strings.Repeat(" ", depth) + "a():\n"
+	}
+	nested += strings.Repeat(" ", 5) + "clear()"
+
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected string
+	}{
+		{"clear()\nclear()", Limits{MaxSourceSize: 10}, "Script is too large (15 bytes, limit is 10)"},
+		{"clear()\nclear()", Limits{MaxTokens: 5}, "Too many tokens (limit is 5) at line 1, pos 5"},
+		{"say(text='hello')", Limits{MaxTextLength: 4}, "Text is too long (5 characters, limit is 4) at line 0, pos 9"},
+		{"set(a=1,b=2,c=3)", Limits{MaxArgs: 2}, "Too many arguments for set (limit is 2) at line 0, pos 12"},
+		{nested, Limits{MaxDepth: 3}, "Blocks are nested too deeply (limit is 3) at line 3, pos 3"},
+		{nested, Limits{}, ""},
+	}
+	for _, test := range tests {
+		parser := NewParser(test.input)
+		parser.Limits = test.limits
+		result := parser.Parse()
+		errs := ""
+		for _, err := range result.Errors {
+			errs += err.Error()
+		}
+		if errs != test.expected {
+			t.Errorf("Unexpected errors for `%s`: expected [%s], got [%s]", test.input, test.expected, errs)
+		}
+	}
+}
+
+func TestParseDefaultLimits(t *testing.T) {
+	input := "a():\n"
+	for depth := 1; depth < 200; depth++ {
+		input += strings.Repeat(" ", depth) + "a():\n"
+	}
+	result := NewParser(input).Parse()
+	if len(result.Errors) != 1 || !strings.HasPrefix(result.Errors[0].Error(), "Blocks are nested too deeply") {
+		t.Errorf("Unexpected errors: %v", result.Errors)
+	}
+
+	result = NewParser("set(" + strings.Repeat("a=1,", 1000) + ")").Parse()
+	if len(result.Errors) != 1 || !strings.HasPrefix(result.Errors[0].Error(), "Too many arguments") {
+		t.Errorf("Unexpected errors: %v", result.Errors)
+	}
+}
+
 func compareResults(t *testing.T, input, expected string, result *ParseResult) {
 	if len(result.Errors) > 0 {
 		t.Errorf("Unexpected errors while parsing `%s`: [%v]", input, result.Errors)
@@ -0,0 +1,482 @@
+package robolang
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const lockFunction = "lock"
+
+// ErrorCodeDeadlock means waiting for a resource would never finish, as the scripts are waiting for each other
+const ErrorCodeDeadlock = "deadlock"
+
+var (
+	// ErrDeadlock is wrapped by the error when waiting for a resource would cause a deadlock
+	ErrDeadlock = errors.New("Deadlock")
+
+	// ErrLockTimeout is wrapped by the error when a resource is not available in time
+	ErrLockTimeout = errors.New("Timed out waiting for a resource")
+)
+
+// LockManager arbitrates between scripts (and the tasks within a script) that use the same exclusive device
+// resources, such as the wheels, speaker or display. A function declares the resources it uses in its definition,
+// and they are locked for the duration of each call; a `lock(resources='wheels,speaker'):` block locks them for all
+// of its children.
+//
+// Requests that cannot be granted straight away wait in a queue, in the order they were made. Each request locks all
+// of its resources at once, and a request that would wait on a script that is already (directly or indirectly)
+// waiting for it, either for a resource it holds or for its turn in the queue, fails with a deadlock error instead.
+//
+// A lock manager can be shared by scripts running on different goroutines. Scripts run by a Scheduler or with Run
+// carry on as soon as they are granted their resources, other scripts carry on the next time they are polled.
+type LockManager struct {
+	// Timeout is how long a request waits for its resources before failing, zero means wait forever. A lock block
+	// can override it with its timeout argument.
+	Timeout time.Duration
+
+	holders map[string]*lockHolder
+	lock    sync.Mutex
+	queue   []*lockRequest
+}
+
+// lockHolder is the task that holds a resource, and how many times it has locked it.
+type lockHolder struct {
+	count int
+	node  *Node
+	owner *task
+}
+
+// lockRequest is a request to lock some resources.
+type lockRequest struct {
+	acquired  []string
+	granted   bool
+	node      *Node
+	owner     *task
+	resources []string
+	wake      func()
+}
+
+// NewLockManager creates a new lock manager
+func NewLockManager() *LockManager {
+	return &LockManager{holders: map[string]*lockHolder{}}
+}
+
+// Holder returns the node (e.g. the function call) that holds a resource, or nil if the resource is free.
+func (m *LockManager) Holder(resource string) *Node {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if holder := m.holders[resource]; holder != nil {
+		return holder.node
+	}
+	return nil
+}
+
+// acquire tries to lock the resources for a request. It returns the nodes holding any resources that are in use if
+// the request has to wait, or an error if waiting would cause a deadlock.
+func (m *LockManager) acquire(req *lockRequest) ([]*Node, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.holders == nil {
+		m.holders = map[string]*lockHolder{}
+	}
+	if m.available(req, nil) {
+		m.take(req)
+		return nil, nil
+	}
+	if m.deadlocked(req) {
+		return nil, ErrDeadlock
+	}
+
+	var holders []*Node
+	for _, resource := range req.resources {
+		if holder := m.holders[resource]; holder != nil && !holder.owns(req.owner) {
+			holders = append(holders, holder.node)
+		}
+	}
+	m.queue = append(m.queue, req)
+	return holders, nil
+}
+
+// isGranted checks whether a queued request has been granted.
+func (m *LockManager) isGranted(req *lockRequest) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return req.granted
+}
+
+// release unlocks the resources held by a request, or removes it from the queue if it is still waiting, and grants
+// any queued requests that can now go ahead.
+func (m *LockManager) release(req *lockRequest) {
+	m.lock.Lock()
+	for pos, other := range m.queue {
+		if other == req {
+			m.queue = append(m.queue[:pos], m.queue[pos+1:]...)
+			break
+		}
+	}
+	for _, resource := range req.acquired {
+		if holder := m.holders[resource]; holder != nil {
+			if holder.count--; holder.count == 0 {
+				delete(m.holders, resource)
+			}
+		}
+	}
+	req.acquired, req.granted = nil, false
+	m.grant()
+}
+
+// releaseAll unlocks everything held or requested by a task that has been stopped.
+func (m *LockManager) releaseAll(owner *task) {
+	m.lock.Lock()
+	var queue []*lockRequest
+	for _, req := range m.queue {
+		if req.owner != owner {
+			queue = append(queue, req)
+		}
+	}
+	m.queue = queue
+	for resource, holder := range m.holders {
+		if holder.owner == owner {
+			delete(m.holders, resource)
+		}
+	}
+	m.grant()
+}
+
+// grant goes through the queue in order, granting any requests that can now go ahead, then unlocks the manager (which
+// must be locked when it is called) and wakes up the scripts that were granted.
+func (m *LockManager) grant() {
+	var wake []func()
+	var queue []*lockRequest
+	waiting := map[string]bool{}
+	for _, req := range m.queue {
+		if !m.available(req, waiting) {
+			// Later requests cannot jump ahead of this one for the same resources
+			for _, resource := range req.resources {
+				waiting[resource] = true
+			}
+			queue = append(queue, req)
+			continue
+		}
+		m.take(req)
+		if req.wake != nil {
+			wake = append(wake, req.wake)
+		}
+	}
+	m.queue = queue
+	m.lock.Unlock()
+
+	for _, fn := range wake {
+		fn()
+	}
+}
+
+// available checks whether all the resources for a request are free (or already held by the same task or one of its
+// parents), and not wanted by an earlier request in the queue.
+func (m *LockManager) available(req *lockRequest, waiting map[string]bool) bool {
+	for _, resource := range req.resources {
+		holder := m.holders[resource]
+		if holder != nil && !holder.owns(req.owner) {
+			return false
+		}
+		if holder == nil && waiting[resource] {
+			return false
+		}
+	}
+	if waiting == nil {
+		for _, other := range m.queue {
+			for _, resource := range other.resources {
+				if m.holders[resource] == nil && req.wants(resource) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// take locks the resources for a request. Resources already held by a parent task are shared with the request
+// rather than locked again.
+func (m *LockManager) take(req *lockRequest) {
+	for _, resource := range req.resources {
+		holder := m.holders[resource]
+		switch {
+		case holder == nil:
+			m.holders[resource] = &lockHolder{count: 1, node: req.node, owner: req.owner}
+		case holder.owner == req.owner:
+			holder.count++
+		default:
+			continue
+		}
+		req.acquired = append(req.acquired, resource)
+	}
+	req.granted = true
+}
+
+// deadlocked checks whether a request would wait (directly or indirectly) on its own task.
+func (m *LockManager) deadlocked(req *lockRequest) bool {
+	seen := map[*task]bool{}
+	blockers := m.blockers(req)
+	for len(blockers) > 0 {
+		owner := blockers[len(blockers)-1]
+		blockers = blockers[:len(blockers)-1]
+		if owner.isAncestorOf(req.owner) {
+			return true
+		}
+		if seen[owner] {
+			continue
+		}
+		seen[owner] = true
+
+		// A task is also waiting for anything that the tasks it started are waiting for
+		for _, other := range m.queue {
+			if owner.isAncestorOf(other.owner) {
+				blockers = append(blockers, m.blockers(other)...)
+			}
+		}
+	}
+	return false
+}
+
+// blockers returns the tasks holding the resources that a request is waiting for, and the tasks with earlier requests
+// in the queue for any of its resources that are free, as the request cannot jump ahead of them.
+func (m *LockManager) blockers(req *lockRequest) []*task {
+	var owners []*task
+	for _, resource := range req.resources {
+		if holder := m.holders[resource]; holder != nil && !holder.owns(req.owner) {
+			owners = append(owners, holder.owner)
+		}
+	}
+	for _, other := range m.queue {
+		if other == req {
+			break
+		}
+		for _, resource := range other.resources {
+			if m.holders[resource] == nil && req.wants(resource) {
+				owners = append(owners, other.owner)
+				break
+			}
+		}
+	}
+	return owners
+}
+
+// owns checks whether a resource held by this holder can be used by a task.
+func (holder *lockHolder) owns(owner *task) bool {
+	return holder.owner.isAncestorOf(owner)
+}
+
+func (req *lockRequest) wants(resource string) bool {
+	for _, wanted := range req.resources {
+		if wanted == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// isAncestorOf checks whether a task is another task or one of its parents.
+func (t *task) isAncestorOf(other *task) bool {
+	for ; other != nil; other = other.parent {
+		if other == t {
+			return true
+		}
+	}
+	return false
+}
+
+// locks returns the script's lock manager, creating one if it does not have one yet.
+func (s *Script) locks() *LockManager {
+	if s.Locks == nil {
+		s.Locks = NewLockManager()
+	}
+	return s.Locks
+}
+
+// resourceLock locks the resources for a function call or a lock block, waiting for them if they are in use.
+type resourceLock struct {
+	locks    *LockManager
+	request  *lockRequest
+	started  time.Time
+	timedOut bool
+	timeout  time.Duration
+	timer    *timer
+}
+
+func newResourceLock(node *Node, resources []string, timeout time.Duration) *resourceLock {
+	return &resourceLock{
+		request: &lockRequest{node: node, resources: resources},
+		timeout: timeout,
+	}
+}
+
+// wait tries to lock the resources, and returns true once they are held. While it returns false the task is blocked
+// until the resources are granted or the timeout expires.
+func (l *resourceLock) wait(t *task) (bool, error) {
+	s, req := t.script, l.request
+	if req.owner == nil {
+		req.owner, req.wake, l.locks = t, s.wake, s.locks()
+		holders, err := l.locks.acquire(req)
+		switch {
+		case errors.Is(err, ErrDeadlock):
+			rt := newRuntimeError(req.node, "Waiting for %s would cause a deadlock", describeResources(req.resources))
+			rt.Code, rt.Err = ErrorCodeDeadlock, ErrDeadlock
+			return false, rt
+		case req.granted:
+			return true, nil
+		}
+
+		l.started = s.now()
+		s.trace(TraceLockWaiting, req.node, map[string]string{
+			"heldBy":    describeHolders(holders),
+			"resources": strings.Join(req.resources, ","),
+		}, "Waiting for %s", describeResources(req.resources))
+		if l.timeout > 0 {
+			l.timer = s.startTimer(l.timeout, func() {
+				l.timer, l.timedOut, t.blocked = nil, true, false
+			})
+		}
+		t.condition, t.blocked = l, true
+		return false, nil
+	}
+
+	if l.ready() {
+		l.stopWaiting(t)
+		s.trace(TraceLockAcquired, req.node, map[string]string{
+			"resources": strings.Join(req.resources, ","),
+			"waited":    FormatDuration(s.now().Sub(l.started)),
+		}, "Acquired %s", describeResources(req.resources))
+		return true, nil
+	}
+	if l.timedOut {
+		l.release(t)
+		rt := newRuntimeError(req.node, "Timed out after %s waiting for %s", FormatDuration(l.timeout), describeResources(req.resources))
+		rt.Code, rt.Err = ErrorCodeTimeout, ErrLockTimeout
+		return false, rt
+	}
+	t.condition, t.blocked = l, true
+	return false, nil
+}
+
+// ready checks whether the resources have been granted.
+func (l *resourceLock) ready() bool {
+	return l.locks != nil && l.locks.isGranted(l.request)
+}
+
+// release unlocks the resources, or stops waiting for them.
+func (l *resourceLock) release(t *task) {
+	l.stopWaiting(t)
+	if l.request.owner != nil {
+		l.locks.release(l.request)
+		l.request.owner = nil
+	}
+}
+
+func (l *resourceLock) stopWaiting(t *task) {
+	if l.timer != nil {
+		t.script.stopTimer(l.timer)
+		l.timer = nil
+	}
+	if t.condition == l {
+		t.condition = nil
+	}
+}
+
+func describeResources(resources []string) string {
+	return "'" + strings.Join(resources, "', '") + "'"
+}
+
+func describeHolders(holders []*Node) string {
+	var names []string
+	for _, node := range holders {
+		if node != nil && node.Token != nil {
+			names = append(names, node.Token.Value)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// parseResources splits a comma separated list of resources (e.g. 'wheels, speaker').
+func parseResources(value string) []string {
+	var resources []string
+	for _, resource := range strings.Split(value, ",") {
+		if resource = strings.TrimSpace(resource); resource != "" {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+// lockFrame executes a `lock(resources='wheels,speaker'):` block, holding the resources until all of its children
+// have finished. The optional timeout argument limits how long to wait for the resources, otherwise the lock
+// manager's timeout is used.
+type lockFrame struct {
+	lock    *resourceLock
+	locked  bool
+	node    *Node
+	started bool
+}
+
+func (f *lockFrame) current() *Node {
+	return f.node
+}
+
+func (f *lockFrame) step(t *task) {
+	if !f.started {
+		f.started = true
+		lock, err := f.parse(t.script)
+		if err != nil {
+			t.pop(wrapRuntimeError(f.node, err))
+			return
+		}
+		f.lock = lock
+	}
+	if !f.locked {
+		held, err := f.lock.wait(t)
+		if err != nil {
+			t.pop(err)
+			return
+		}
+		if held {
+			f.locked = true
+			t.push(&blockFrame{nodes: f.node.Children})
+		}
+		return
+	}
+
+	f.lock.release(t)
+	t.pop(t.result)
+}
+
+// cancel unlocks the resources when the block is discarded.
+func (f *lockFrame) cancel(t *task) bool {
+	if f.lock != nil {
+		f.lock.release(t)
+	}
+	return false
+}
+
+func (f *lockFrame) parse(s *Script) (*resourceLock, error) {
+	call := newCall(s, f.node)
+	value, err := call.Value("resources")
+	if err != nil {
+		return nil, err
+	}
+	resources := parseResources(value)
+	if len(resources) == 0 {
+		return nil, newRuntimeError(f.node, "'%s' needs at least one resource", lockFunction)
+	}
+
+	timeout := s.locks().Timeout
+	if call.Arg("timeout") != nil {
+		if timeout, err = call.Duration("timeout"); err != nil {
+			return nil, err
+		}
+		if timeout <= 0 {
+			return nil, newRuntimeError(f.node, "The timeout of '%s' must be more than zero", lockFunction)
+		}
+	}
+	return newResourceLock(f.node, resources, timeout), nil
+}
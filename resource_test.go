@@ -0,0 +1,196 @@
+package robolang
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResourceLocksBetweenScripts(t *testing.T) {
+	var log []string
+	var events []string
+	locks := NewLockManager()
+	scheduler := NewScheduler(nil)
+	first := addScheduledScript(t, scheduler, "first", newLockScript(t, "move()\nspeak(text='first done')", locks, &log), 0)
+	second := newLockScript(t, "speak(text='second')\nmove()\nspeak(text='second done')", locks, &log)
+	second.Tracer = TracerFunc(func(event *TraceEvent) {
+		if event.Kind == TraceLockWaiting || event.Kind == TraceLockAcquired {
+			events = append(events, event.Message+" "+event.Attributes["heldBy"])
+		}
+	})
+	secondEntry := addScheduledScript(t, scheduler, "second", second, 0)
+
+	scheduler.Run()
+	checkLog(t, log, "wait,second")
+	if holder := locks.Holder("wheels"); holder == nil || holder.Token.Value != "move" {
+		t.Errorf("Unexpected holder: %v", holder)
+	}
+	if err := first.Resume("a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	scheduler.Run()
+	checkLog(t, log, "wait,second,input:a,wait,first done")
+	if err := secondEntry.Resume("b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	scheduler.Run()
+	checkLog(t, log, "wait,second,input:a,wait,first done,input:b,second done")
+	checkLog(t, events, "Waiting for 'wheels' move,Acquired 'wheels' ")
+	if holder := locks.Holder("wheels"); holder != nil {
+		t.Errorf("Unexpected holder: %v", holder)
+	}
+}
+
+func TestResourceLocks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		// Calls in parallel branches take turns
+		{"parallel():\n  move()\n  move()\nspeak(text='done')", "wait,input:1,wait,input:2,done", ""},
+		// Calls that use different resources do not
+		{"parallel():\n  move()\n  speak(text='hello')", "wait,hello,input:1", ""},
+		// Resources locked by a block are shared by its children
+		{"lock(resources='wheels, speaker'):\n  parallel():\n    move()\n    move()\n    speak(text='hello')", "wait,wait,hello,input:1,input:2", ""},
+		{"lock(resources=''):\n  move()", "", "'lock' needs at least one resource at line 0, pos 0"},
+		{"lock(resources='wheels', timeout=0s):\n  move()", "", "The timeout of 'lock' must be more than zero at line 0, pos 0"},
+	}
+
+	for _, test := range tests {
+		var log []string
+		script := newLockScript(t, test.input, NewLockManager(), &log)
+		err := script.Start()
+		for count := 1; err == nil && script.State == ScriptStateWaiting; count++ {
+			err = script.Resume(string(rune('0' + count)))
+		}
+		if test.err == "" && err != nil {
+			t.Errorf("Unexpected error for `%s`: %v", test.input, err)
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("Unexpected error for `%s`: expected %s, got %v", test.input, test.err, err)
+		}
+		checkLog(t, log, test.expected)
+	}
+}
+
+func TestResourceLockTimeout(t *testing.T) {
+	var log []string
+	locks := NewLockManager()
+	locks.Timeout = time.Second
+	clock := NewManualClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := NewScheduler(nil)
+	scheduler.Clock = clock
+	addScheduledScript(t, scheduler, "first", newLockScript(t, "lock(resources='wheels', timeout=1m):\n  waitForInput()", locks, &log), 0)
+	second := addScheduledScript(t, scheduler, "second", newLockScript(t, "try():\n  move()\ncatch(error=&err):\n  speak(text='{&err} ({&err.code})')", locks, &log), 0)
+
+	scheduler.Run()
+	checkLog(t, log, "wait")
+	clock.Advance(time.Second)
+	scheduler.Run()
+	checkLog(t, log, "wait,Timed out after 1s waiting for 'wheels' (timeout)")
+	if second.Script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), second.Script.State.String())
+	}
+}
+
+func TestResourceDeadlock(t *testing.T) {
+	var log []string
+	locks := NewLockManager()
+	scheduler := NewScheduler(nil)
+	first := addScheduledScript(t, scheduler, "first", newLockScript(t, "lock(resources='wheels'):\n  waitForInput()\n  lock(resources='speaker'):\n    speak(text='first')", locks, &log), 0)
+	second := addScheduledScript(t, scheduler, "second", newLockScript(t, "lock(resources='speaker'):\n  waitForInput()\n  lock(resources='wheels'):\n    speak(text='second')", locks, &log), 0)
+
+	scheduler.Run()
+	checkLog(t, log, "wait,wait")
+	if err := first.Resume("a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	scheduler.Run()
+	if err := second.Resume("b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	scheduler.Run()
+
+	err := second.Err()
+	if !errors.Is(err, ErrDeadlock) || err.Error() != "Waiting for 'wheels' would cause a deadlock at line 2, pos 2" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,wait,input:a,input:b,first")
+	if first.Script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), first.Script.State.String())
+	}
+}
+
+func TestResourceDeadlockInQueue(t *testing.T) {
+	var log []string
+	locks := NewLockManager()
+	scheduler := NewScheduler(nil)
+	holding := addScheduledScript(t, scheduler, "holding", newLockScript(t, "lock(resources='wheels'):\n  waitForInput()\n  speak(text='holding')", locks, &log), 0)
+	queued := addScheduledScript(t, scheduler, "queued", newLockScript(t, "lock(resources='wheels, speaker'):\n  speak(text='queued')", locks, &log), 0)
+
+	// The speaker is free, but the queued request is first in line for it, and is waiting for the wheels
+	scheduler.Run()
+	checkLog(t, log, "wait")
+	if err := holding.Resume("a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	scheduler.Run()
+
+	err := holding.Err()
+	if !errors.Is(err, ErrDeadlock) || err.Error() != "Waiting for 'speaker' would cause a deadlock at line 2, pos 2" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,input:a,queued")
+	if queued.Script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), queued.Script.State.String())
+	}
+}
+
+func TestResourceLocksWithExecutions(t *testing.T) {
+	var firstLog, secondLog []string
+	locks := NewLockManager()
+	first, err := newLockScript(t, "move()", locks, &firstLog).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForState(t, first, ScriptStateWaiting)
+	second, err := newLockScript(t, "move()", locks, &secondLog).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForState(t, second, ScriptStateWaiting)
+
+	if err := first.Input("a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := first.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The second script carries on as soon as the first releases the wheels
+	waitForState(t, second, ScriptStateRunning)
+	waitForState(t, second, ScriptStateWaiting)
+	if err := second.Input("b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := second.Wait(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, firstLog, "wait,input:a")
+	checkLog(t, secondLog, "wait,input:b")
+}
+
+// newLockScript builds a test script with a move function that uses the wheels (and waits for input), and a speak
+// function that uses the speaker.
+func newLockScript(t *testing.T, input string, locks *LockManager, log *[]string) *Script {
+	script := newTestScript(t, input, log)
+	script.Locks = locks
+	script.Functions.Functions["move"] = NewFunction("move").UseResources("wheels").SetFunction(&waitForInput{log: log})
+	script.Functions.Functions["speak"] = NewFunction("speak").UseResources("speaker").SetFunction(FunctionFunc(func(call *Call) error {
+		text, err := call.Value("text")
+		*log = append(*log, text)
+		return err
+	}))
+	return script
+}
@@ -0,0 +1,177 @@
+package robolang
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+const retryFunction = "retry"
+
+// retryFrame executes a `retry(times=3, backoff=2s, factor=2):` block, running its children again whenever they fail.
+//
+// The arguments are all optional:
+//   - times is the maximum number of attempts (default 3)
+//   - backoff is how long to wait before the first retry (default no wait)
+//   - factor multiplies the wait before each retry after that (default 2)
+//   - jitter randomly varies each wait by up to that fraction (e.g. 0.1 for 10%), using the script's Random source
+//   - attempt is the variable that holds the number of the current attempt, starting at 1 (default &attempt)
+//
+// Errors in the script itself (e.g. an unknown function) are not retried.
+type retryFrame struct {
+	attempt    int
+	backingOff bool
+	backoff    time.Duration
+	factor     float64
+	jitter     float64
+	node       *Node
+	started    bool
+	timer      *timer
+	times      int
+	variable   string
+}
+
+func (f *retryFrame) current() *Node {
+	return f.node
+}
+
+func (f *retryFrame) step(t *task) {
+	if !f.started {
+		f.started = true
+		if err := f.parse(newCall(t.script, f.node)); err != nil {
+			t.pop(wrapRuntimeError(f.node, err))
+			return
+		}
+		f.run(t)
+		return
+	}
+	if f.backingOff {
+		f.backingOff = false
+		f.run(t)
+		return
+	}
+
+	err := t.result
+	switch {
+	case err == nil:
+		if f.attempt > 1 {
+			t.script.audit(f.node, "Succeeded on attempt %d of %d", f.attempt, f.times)
+		}
+		t.pop(nil)
+		return
+	case !isRetryable(err):
+		t.pop(err)
+		return
+	case f.attempt >= f.times:
+		t.script.audit(f.node, "Gave up after %d attempts: %s", f.attempt, asRuntimeError(f.node, err).Message)
+		t.pop(err)
+		return
+	}
+
+	delay := f.delay(t.script)
+	message := asRuntimeError(f.node, err).Message
+	t.script.trace(TraceRetry, f.node, map[string]string{
+		"attempt": strconv.Itoa(f.attempt + 1),
+		"delay":   FormatDuration(delay),
+		"error":   message,
+		"times":   strconv.Itoa(f.times),
+	}, "Retrying after attempt %d of %d failed", f.attempt, f.times)
+	t.script.audit(f.node, "Attempt %d of %d failed, retrying in %s: %s", f.attempt, f.times, FormatDuration(delay), message)
+
+	f.backingOff = true
+	if delay > 0 {
+		t.blocked = true
+		f.timer = t.script.startTimer(delay, func() {
+			f.timer, t.blocked = nil, false
+		})
+	}
+}
+
+// cancel stops the backoff timer when the block is discarded.
+func (f *retryFrame) cancel(t *task) bool {
+	if f.timer != nil {
+		t.script.stopTimer(f.timer)
+		f.timer = nil
+	}
+	return false
+}
+
+// delay calculates how long to wait before the next attempt.
+func (f *retryFrame) delay(s *Script) time.Duration {
+	delay := float64(f.backoff) * math.Pow(f.factor, float64(f.attempt-1))
+	if f.jitter > 0 {
+		delay *= 1 + f.jitter*(2*s.random().Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+func (f *retryFrame) parse(call *Call) error {
+	f.times, f.factor, f.variable = 3, 2, "attempt"
+	for _, arg := range call.Node.Args {
+		name := arg.Token.Value
+		switch name {
+		case "times":
+			value, err := call.Value(name)
+			if err != nil {
+				return err
+			}
+			if f.times, err = strconv.Atoi(value); err != nil || f.times < 1 {
+				return newRuntimeError(arg, "Retry argument 'times' must be a whole number of at least 1, found '%s'", value)
+			}
+		case "backoff":
+			backoff, err := call.Duration(name)
+			if err != nil {
+				return err
+			}
+			f.backoff = backoff
+		case "factor", "jitter":
+			value, err := call.Value(name)
+			if err != nil {
+				return err
+			}
+			number, err := strconv.ParseFloat(value, 64)
+			if name == "factor" {
+				if err != nil || number < 1 {
+					return newRuntimeError(arg, "Retry argument 'factor' must be a number of at least 1, found '%s'", value)
+				}
+				f.factor = number
+			} else {
+				if err != nil || number < 0 || number > 1 {
+					return newRuntimeError(arg, "Retry argument 'jitter' must be a number between 0 and 1, found '%s'", value)
+				}
+				f.jitter = number
+			}
+		case "attempt":
+			value := call.Arg(name)
+			if value == nil || value.Type != NodeVariable {
+				return newRuntimeError(arg, "Retry argument 'attempt' must be a variable")
+			}
+			f.variable = value.Token.Value
+		default:
+			return newRuntimeError(arg, "Unknown retry argument '%s'", name)
+		}
+	}
+	return nil
+}
+
+// run starts the next attempt.
+func (f *retryFrame) run(t *task) {
+	f.attempt++
+	t.script.setVariable(f.variable, strconv.Itoa(f.attempt))
+	t.push(&blockFrame{nodes: f.node.Children})
+}
+
+// isRetryable checks whether an error could go away by trying again.
+func isRetryable(err error) bool {
+	code := asRuntimeError(nil, err).Code
+	return code != ErrorCodeScript && code != ErrorCodeUnknownFunction
+}
+
+// random returns the script's source of random numbers, which is seeded from the current time unless it is set.
+func (s *Script) random() *rand.Rand {
+	if s.Random == nil {
+		s.Random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return s.Random
+}
@@ -0,0 +1,129 @@
+package robolang
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		input    string
+		failures int
+		expected string
+		err      string
+	}{
+		{"retry(times=3):\n  flaky()\n  say(text='ok {&attempt}')", 0, "flaky,ok 1", ""},
+		{"retry(times=3):\n  flaky()\n  say(text='ok {&attempt}')", 2, "flaky,flaky,flaky,ok 3", ""},
+		{"retry(times=3):\n  flaky()\nsay(text='skipped')", 3, "flaky,flaky,flaky", "Flaky failure at line 1, pos 2"},
+		{"retry(attempt=&n):\n  say(text='try {&n}')\n  isTrue(value='no')", 0, "try 1,try 2,try 3", "'isTrue' failed at line 2, pos 2"},
+		{"retry():\n  unknown()", 0, "", "Unknown function 'unknown' at line 1, pos 2"},
+		{"retry(times=0):\n  flaky()", 0, "", "Retry argument 'times' must be a whole number of at least 1, found '0' at line 0, pos 6"},
+		{"retry(factor=0.5):\n  flaky()", 0, "", "Retry argument 'factor' must be a number of at least 1, found '0.5' at line 0, pos 6"},
+		{"retry(jitter=2):\n  flaky()", 0, "", "Retry argument 'jitter' must be a number between 0 and 1, found '2' at line 0, pos 6"},
+		{"retry(attempt='n'):\n  flaky()", 0, "", "Retry argument 'attempt' must be a variable at line 0, pos 6"},
+		{"retry(wait=1):\n  flaky()", 0, "", "Unknown retry argument 'wait' at line 0, pos 6"},
+	}
+	for _, test := range tests {
+		var log []string
+		script := newRetryScript(t, test.input, &log, test.failures)
+		err := script.Start()
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("Unexpected error for `%s`: expected [%s], got [%v]", test.input, test.err, err)
+		}
+		if actual := strings.Join(log, ","); actual != test.expected {
+			t.Errorf("Unexpected log for `%s`: expected [%s], got [%s]", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var log []string
+	clock := NewManualClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	script := newRetryScript(t, "retry(times=4, backoff=2s, factor=3):\n  flaky()\nsay(text='done')", &log, 3)
+	script.Clock = clock
+	script.AuditLog = NewAuditLog()
+	var delays []string
+	script.Tracer = TracerFunc(func(event *TraceEvent) {
+		if event.Kind == TraceRetry {
+			delays = append(delays, event.Attributes["attempt"]+":"+event.Attributes["delay"])
+		}
+	})
+
+	script.Start()
+	checkLog(t, log, "flaky")
+	for _, wait := range []time.Duration{2 * time.Second, 6 * time.Second, 18 * time.Second} {
+		clock.Advance(wait - time.Millisecond)
+		script.Poll()
+		if script.State != ScriptStateWaiting {
+			t.Fatalf("Unexpected script state: expected %s, actual %s", ScriptStateWaiting.String(), script.State.String())
+		}
+		clock.Advance(time.Millisecond)
+		script.Poll()
+	}
+	checkLog(t, log, "flaky,flaky,flaky,flaky,done")
+	if actual := strings.Join(delays, ","); actual != "2:2s,3:6s,4:18s" {
+		t.Errorf("Unexpected retry traces: %s", actual)
+	}
+
+	var audit []string
+	for _, entry := range script.AuditLog.Entries() {
+		audit = append(audit, entry.String())
+	}
+	expected := "Attempt 1 of 4 failed, retrying in 2s: Flaky failure at line 0, pos 0\n" +
+		"Attempt 2 of 4 failed, retrying in 6s: Flaky failure at line 0, pos 0\n" +
+		"Attempt 3 of 4 failed, retrying in 18s: Flaky failure at line 0, pos 0\n" +
+		"Succeeded on attempt 4 of 4 at line 0, pos 0"
+	if actual := strings.Join(audit, "\n"); actual != expected {
+		t.Errorf("Unexpected audit log: expected\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func TestRetryJitter(t *testing.T) {
+	delays := func(seed int64) string {
+		var log, delays []string
+		script := newRetryScript(t, "retry(times=5, backoff=10s, factor=1, jitter=0.5):\n  flaky()", &log, 10)
+		script.Clock = NewManualClock(time.Now())
+		script.Random = rand.New(rand.NewSource(seed))
+		script.Tracer = TracerFunc(func(event *TraceEvent) {
+			if event.Kind == TraceRetry {
+				delays = append(delays, event.Attributes["delay"])
+			}
+		})
+		script.Start()
+		for script.State == ScriptStateWaiting {
+			deadline, _ := script.NextDeadline()
+			script.Clock.(*ManualClock).Advance(deadline.Sub(script.Clock.Now()))
+			script.Poll()
+		}
+		return strings.Join(delays, ",")
+	}
+
+	first := delays(42)
+	if first != delays(42) {
+		t.Errorf("Expected the same delays with the same seed")
+	}
+	if first == delays(7) {
+		t.Errorf("Expected different delays with a different seed")
+	}
+	for _, delay := range strings.Split(first, ",") {
+		quantity, err := Units.Parse(delay)
+		if err != nil || quantity.Value < 5 || quantity.Value > 15 {
+			t.Errorf("Unexpected delay %s, expected between 5s and 15s", delay)
+		}
+	}
+}
+
+func newRetryScript(t *testing.T, input string, log *[]string, failures int) *Script {
+	script := newBehaviourScript(t, input, log)
+	script.Functions.Functions["flaky"] = NewFunction("flaky").SetFunction(FunctionFunc(func(call *Call) error {
+		*log = append(*log, "flaky")
+		if failures > 0 {
+			failures--
+			return NewError("hardware", "Flaky failure")
+		}
+		return nil
+	}))
+	return script
+}
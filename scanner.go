@@ -3,6 +3,7 @@ package robolang
 import (
 	"bufio"
 	"bytes"
+	"strings"
 )
 
 // Scanner is used for splitting an input stream into tokens.
@@ -10,6 +11,16 @@ type Scanner struct {
 	lineNum int
 	linePos int
 	r       *bufio.Reader
+	source  bytes.Buffer
+	prev    struct {
+		lineNum int
+		linePos int
+		size    int
+	}
+	start struct {
+		lineNum int
+		linePos int
+	}
 }
 
 // NewScanner starts a new scanner.
@@ -20,6 +31,8 @@ func NewScanner(s string) *Scanner {
 
 // Scan reads the next token from the input stream.
 func (s *Scanner) Scan() *Token {
+	s.start.lineNum, s.start.linePos = s.lineNum, s.linePos
+	s.source.Reset()
 	ch := s.read()
 
 	// Check the multi-character tokens
@@ -45,12 +58,7 @@ func (s *Scanner) Scan() *Token {
 	// Check the single character tokens
 	t, ok := chars[ch]
 	if ok {
-		tok := s.makeToken(t, string(ch))
-		if t == TokenNewLine {
-			s.linePos = 0
-			s.lineNum++
-		}
-		return tok
+		return s.makeToken(t, string(ch))
 	}
 
 	return s.makeToken(TokenIllegal, string(ch))
@@ -98,24 +106,53 @@ func (s *Scanner) makeToken(t TokenType, v string) *Token {
 		Type:     t,
 		TypeName: t.String(),
 		Value:    v,
-		LineNum:  s.lineNum,
-		LinePos:  s.linePos - len(v),
+		LineNum:  s.start.lineNum,
+		LinePos:  s.start.linePos,
+		Source:   s.source.String(),
+	}
+}
+
+// peekUnit looks ahead for a registered unit suffix without consuming any input.
+func (s *Scanner) peekUnit() string {
+	n := 0
+	for {
+		b, err := s.r.Peek(n + 1)
+		if err != nil || !(s.isLetter(rune(b[n])) || b[n] == '%') {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		return ""
+	}
+
+	b, _ := s.r.Peek(n)
+	unit := string(b)
+	if _, ok := Units.Get(unit); !ok {
+		return ""
 	}
+	return unit
 }
 
 func (s *Scanner) read() rune {
-	s.linePos++
-	ch, _, err := s.r.ReadRune()
+	s.prev.lineNum, s.prev.linePos, s.prev.size = s.lineNum, s.linePos, 0
+	ch, size, err := s.r.ReadRune()
 
 	if err != nil {
 		return eof
 	}
+	s.linePos++
+	s.source.WriteRune(ch)
+	s.prev.size = size
+	if ch == '\n' {
+		s.lineNum++
+		s.linePos = 0
+	}
 	return ch
 }
 
 func (s *Scanner) scanComment() *Token {
 	var buf bytes.Buffer
-	buf.WriteRune(s.read())
 	for {
 		if ch := s.read(); ch == eof {
 			break
@@ -126,6 +163,9 @@ func (s *Scanner) scanComment() *Token {
 			buf.WriteRune(ch)
 		}
 	}
+	if value := buf.String(); strings.HasPrefix(value, "!") {
+		return s.makeToken(TokenDirective, value[1:])
+	}
 	return s.makeToken(TokenComment, buf.String())
 }
 
@@ -165,6 +205,17 @@ func (s *Scanner) scanNumber() *Token {
 		if ch := s.read(); ch == eof {
 			break
 		} else if !s.isDigit(ch) && !numbers[ch] {
+			if !isDuration {
+				s.unread()
+				if unit := s.peekUnit(); unit != "" {
+					if len(unit) > 1 || !elements[rune(unit[0])] {
+						s.skip(len(unit))
+						buf.WriteString(unit)
+						return s.makeToken(TokenQuantity, buf.String())
+					}
+				}
+				ch = s.read()
+			}
 			if elements[ch] {
 				isDuration = true
 				elements[ch] = false
@@ -187,8 +238,12 @@ func (s *Scanner) scanNumber() *Token {
 }
 
 func (s *Scanner) scanText() *Token {
+	if b, err := s.r.Peek(2); err == nil && string(b) == "''" {
+		s.skip(2)
+		return s.scanMultiLineText()
+	}
+
 	var buf bytes.Buffer
-	buf.WriteRune(s.read())
 	for {
 		if ch := s.read(); ch == eof {
 			break
@@ -198,7 +253,66 @@ func (s *Scanner) scanText() *Token {
 			buf.WriteRune(ch)
 		}
 	}
-	return s.makeToken(TokenText, buf.String())
+	tok := s.makeToken(TokenText, buf.String())
+	tok.valueLine, tok.valuePos = tok.LineNum, tok.LinePos+1
+	return tok
+}
+
+// scanMultiLineText reads a triple-quoted text literal. The common indentation is stripped from every line, along with
+// the line containing the opening quotes and the line containing the closing quotes when they are otherwise blank.
+func (s *Scanner) scanMultiLineText() *Token {
+	var buf bytes.Buffer
+	for quotes := 0; quotes < 3; {
+		ch := s.read()
+		if ch == eof {
+			break
+		} else if ch == '\'' {
+			quotes++
+			continue
+		}
+		for ; quotes > 0; quotes-- {
+			buf.WriteRune('\'')
+		}
+		buf.WriteRune(ch)
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+	valueLine, valuePos, first := s.start.lineNum, s.start.linePos+3, 1
+	if len(lines) > 1 && strings.TrimLeft(lines[0], " \t\r") == "" {
+		lines = lines[1:]
+		valueLine, valuePos, first = valueLine+1, 0, 0
+	}
+	if len(lines) > 1 && strings.TrimLeft(lines[len(lines)-1], " \t\r") == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	indent := -1
+	for _, line := range lines[first:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.TrimRight(trimmed, "\r") == "" {
+			continue
+		}
+		if width := len(line) - len(trimmed); indent < 0 || width < indent {
+			indent = width
+		}
+	}
+	if indent < 0 {
+		indent = 0
+	}
+	for pos := first; pos < len(lines); pos++ {
+		if len(lines[pos]) < indent {
+			lines[pos] = ""
+		} else {
+			lines[pos] = lines[pos][indent:]
+		}
+	}
+	if first == 0 {
+		valuePos += indent
+	}
+
+	tok := s.makeToken(TokenText, strings.Join(lines, "\n"))
+	tok.valueLine, tok.valuePos, tok.valueIndent = valueLine, valuePos, indent
+	return tok
 }
 
 func (s *Scanner) scanWhitespace() string {
@@ -217,7 +331,15 @@ func (s *Scanner) scanWhitespace() string {
 	return buf.String()
 }
 
+func (s *Scanner) skip(n int) {
+	for ; n > 0; n-- {
+		s.read()
+	}
+}
+
 func (s *Scanner) unread() {
-	s.linePos--
+	s.lineNum, s.linePos = s.prev.lineNum, s.prev.linePos
+	s.source.Truncate(s.source.Len() - s.prev.size)
+	s.prev.size = 0
 	_ = s.r.UnreadRune()
 }
@@ -21,6 +21,10 @@ func TestScanTokens(t *testing.T) {
 		{"@test", Token{Type: TokenResource, Value: "test"}},
 		{"test", Token{Type: TokenIdentifier, Value: "test"}},
 		{"'text'", Token{Type: TokenText, Value: "text"}},
+		{"''", Token{Type: TokenText, Value: ""}},
+		{"'''one\n  two'''", Token{Type: TokenText, Value: "one\ntwo"}},
+		{"'''\n    one\n      two\n    '''", Token{Type: TokenText, Value: "one\n  two"}},
+		{"'''it's'''", Token{Type: TokenText, Value: "it's"}},
 		{"1", Token{Type: TokenNumber, Value: "1"}},
 		{"1.2", Token{Type: TokenNumber, Value: "1.2"}},
 		{"1d", Token{Type: TokenDuration, Value: "1d"}},
@@ -28,6 +32,12 @@ func TestScanTokens(t *testing.T) {
 		{"1m", Token{Type: TokenDuration, Value: "1m"}},
 		{"1s", Token{Type: TokenDuration, Value: "1s"}},
 		{"1d2h3m4s", Token{Type: TokenDuration, Value: "1d2h3m4s"}},
+		{"30cm", Token{Type: TokenQuantity, Value: "30cm"}},
+		{"90deg", Token{Type: TokenQuantity, Value: "90deg"}},
+		{"40%", Token{Type: TokenQuantity, Value: "40%"}},
+		{"1.5mps", Token{Type: TokenQuantity, Value: "1.5mps"}},
+		{"250ms", Token{Type: TokenQuantity, Value: "250ms"}},
+		{"2xyz", Token{Type: TokenNumber, Value: "2"}},
 		{"+", Token{Type: TokenOperator, Value: "+"}},
 		{"-", Token{Type: TokenOperator, Value: "-"}},
 		{"*", Token{Type: TokenOperator, Value: "*"}},
@@ -36,6 +46,8 @@ func TestScanTokens(t *testing.T) {
 		{"<", Token{Type: TokenOperator, Value: "<"}},
 		{">", Token{Type: TokenOperator, Value: ">"}},
 		{"# a comment", Token{Type: TokenComment, Value: " a comment"}},
+		{"#\n", Token{Type: TokenComment, Value: ""}},
+		{"#! robolang 1.1", Token{Type: TokenDirective, Value: " robolang 1.1"}},
 		{"!", Token{Type: TokenIllegal, Value: "!"}},
 	}
 
@@ -84,3 +96,26 @@ func TestScanLocation(t *testing.T) {
 		tok = scanner.Scan()
 	}
 }
+
+func TestScanLocationMultiLineText(t *testing.T) {
+	input := "say(text='''\n  Hello\n  {&name}\n  ''')\nclear()"
+	scanner := NewScanner(input)
+	var text, last *Token
+	for tok := scanner.Scan(); tok.Type != TokenEOF; tok = scanner.Scan() {
+		if tok.Type == TokenText {
+			text = tok
+		}
+		last = tok
+	}
+
+	if text == nil || text.LineNum != 0 || text.LinePos != 9 {
+		t.Fatalf("Unexpected text token: %+v", text)
+	}
+	if last.Value != ")" || last.LineNum != 4 || last.LinePos != 6 {
+		t.Errorf("Unexpected location for last token: expected [4,6], got [%d,%d]", last.LineNum, last.LinePos)
+	}
+	lineNum, linePos := text.ValuePosition(6)
+	if lineNum != 2 || linePos != 2 {
+		t.Errorf("Unexpected location for value offset 6: expected [2,2], got [%d,%d]", lineNum, linePos)
+	}
+}
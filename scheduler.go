@@ -0,0 +1,248 @@
+package robolang
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Scheduler runs several scripts on the same robot (e.g. a show, a battery monitor and an idle animation), sharing
+// time between them. Scripts only switch at safe points (node boundaries), so a higher priority script can preempt a
+// lower priority one, and the preempted script carries on from where it stopped once it gets another turn.
+//
+// The scheduler does not start any goroutines: each call to Step runs a single node boundary in one script, so with
+// a ManualClock the interleaving of the scripts is completely reproducible.
+type Scheduler struct {
+	// Clock is used by any scripts that are added without their own clock
+	Clock Clock
+
+	// Policy chooses which script runs next, the default is PriorityPolicy
+	Policy SchedulingPolicy
+
+	// Scripts are the scripts being run, in the order they were added
+	Scripts []*ScheduledScript
+
+	current *ScheduledScript
+	steps   int
+}
+
+// ScheduledScript is a script that is run by a scheduler
+type ScheduledScript struct {
+	Name      string
+	Preempted int
+	Priority  int
+	Script    *Script
+
+	allowed  bool
+	lastStep int
+	woken    bool
+}
+
+// NewScheduler creates a new scheduler with a scheduling policy (nil means PriorityPolicy).
+func NewScheduler(policy SchedulingPolicy) *Scheduler {
+	return &Scheduler{Policy: policy}
+}
+
+// Add adds a script to the scheduler. The script must not have been started yet, as the scheduler starts it on its
+// first turn.
+func (sc *Scheduler) Add(name string, script *Script, priority int) (*ScheduledScript, error) {
+	if sc.Get(name) != nil {
+		return nil, fmt.Errorf("A script called '%s' has already been added", name)
+	}
+	if script.State != ScriptStatePending || script.yield != nil {
+		return nil, fmt.Errorf("Script '%s' has already been started", name)
+	}
+	if script.Clock == nil {
+		script.Clock = sc.Clock
+	}
+
+	entry := &ScheduledScript{
+		Name:     name,
+		Priority: priority,
+		Script:   script,
+	}
+	script.setWake(entry.wake)
+	script.yield = entry.yield
+	sc.Scripts = append(sc.Scripts, entry)
+	return entry, nil
+}
+
+// Get finds a script by name, it returns nil if there is no script with that name.
+func (sc *Scheduler) Get(name string) *ScheduledScript {
+	for _, entry := range sc.Scripts {
+		if entry.Name == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+// NextDeadline returns the time that the earliest timer (e.g. a timeout) in any waiting script expires.
+func (sc *Scheduler) NextDeadline() (time.Time, bool) {
+	var next time.Time
+	found := false
+	for _, entry := range sc.Scripts {
+		if deadline, ok := entry.Script.NextDeadline(); ok && (!found || deadline.Before(next)) {
+			next, found = deadline, true
+		}
+	}
+	return next, found
+}
+
+// Run steps through the scripts until they have all finished, failed, or are waiting for something external (e.g.
+// input or a timer).
+func (sc *Scheduler) Run() {
+	for sc.Step() != nil {
+	}
+}
+
+// Step runs a single node boundary in the script chosen by the policy, and returns the script. It returns nil if
+// none of the scripts can run.
+func (sc *Scheduler) Step() *ScheduledScript {
+	var candidates []*ScheduledScript
+	for _, entry := range sc.Scripts {
+		if entry.runnable() {
+			candidates = append(candidates, entry)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].lastStep < candidates[j].lastStep
+	})
+
+	policy := sc.Policy
+	if policy == nil {
+		policy = PriorityPolicy{}
+	}
+	next := policy.Select(candidates)
+	if next == nil {
+		return nil
+	}
+	if previous := sc.current; previous != nil && previous != next && previous.Priority < next.Priority && previous.runnable() {
+		previous.Preempted++
+		previous.Script.trace(TracePreempted, previous.Script.current, map[string]string{"by": next.Name}, "Preempted by '%s'", next.Name)
+	}
+
+	sc.steps++
+	sc.current, next.lastStep = next, sc.steps
+	next.step()
+	return next
+}
+
+// Cancel stops the script, running any finally blocks that are active during its next turns.
+func (entry *ScheduledScript) Cancel() error {
+	return entry.Script.Cancel()
+}
+
+// Err returns the error that stopped the script, if it has failed.
+func (entry *ScheduledScript) Err() error {
+	if entry.Script.State != ScriptStateFailed {
+		return nil
+	}
+	return entry.Script.err
+}
+
+// Raise triggers any handlers for an event in the script. The handlers run during the script's next turns.
+func (entry *ScheduledScript) Raise(event string) error {
+	return entry.Script.Raise(event)
+}
+
+// Resume passes input to any functions in the script that are waiting for it. The script continues on its next turn.
+func (entry *ScheduledScript) Resume(input string) error {
+	return entry.Script.Resume(input)
+}
+
+// runnable checks whether the script can take a step: it has not started yet, it was paused between turns, one of
+// its timers has expired, or it has been woken up by a resource being granted or an event being published.
+func (entry *ScheduledScript) runnable() bool {
+	switch entry.Script.State {
+	case ScriptStatePending, ScriptStatePaused:
+		return true
+	case ScriptStateWaiting:
+		deadline, ok := entry.Script.NextDeadline()
+		return entry.woken || (ok && !entry.Script.now().Before(deadline))
+	}
+	return false
+}
+
+// step lets the script run until its next node boundary.
+func (entry *ScheduledScript) step() {
+	entry.allowed, entry.woken = true, false
+	switch entry.Script.State {
+	case ScriptStatePending:
+		entry.Script.Start()
+	case ScriptStatePaused:
+		entry.Script.run()
+	case ScriptStateWaiting:
+		entry.Script.Poll()
+	}
+	entry.allowed = false
+}
+
+// wake marks the script as runnable when it is granted a resource or an event is published for it.
+func (entry *ScheduledScript) wake() {
+	entry.woken = true
+}
+
+// yield allows the script to take a single step each turn.
+func (entry *ScheduledScript) yield() bool {
+	allowed := entry.allowed
+	entry.allowed = false
+	return allowed
+}
+
+// SchedulingPolicy chooses which script a scheduler runs next. The candidates are the scripts that can run, starting
+// with the one that has waited longest since its last turn.
+type SchedulingPolicy interface {
+	Select(candidates []*ScheduledScript) *ScheduledScript
+}
+
+// SchedulingPolicyFunc adapts an ordinary Go function to a SchedulingPolicy
+type SchedulingPolicyFunc func(candidates []*ScheduledScript) *ScheduledScript
+
+// Select calls the function
+func (fn SchedulingPolicyFunc) Select(candidates []*ScheduledScript) *ScheduledScript {
+	return fn(candidates)
+}
+
+// PriorityPolicy runs the highest priority script that can run, sharing time between scripts with the same priority.
+// Lower priority scripts only run while all the higher priority scripts are waiting or have finished.
+type PriorityPolicy struct{}
+
+// Select chooses the highest priority candidate
+func (PriorityPolicy) Select(candidates []*ScheduledScript) *ScheduledScript {
+	next := candidates[0]
+	for _, entry := range candidates[1:] {
+		if entry.Priority > next.Priority {
+			next = entry
+		}
+	}
+	return next
+}
+
+// RoundRobinPolicy shares time equally between the scripts, ignoring their priorities.
+type RoundRobinPolicy struct{}
+
+// Select chooses the candidate that has waited longest
+func (RoundRobinPolicy) Select(candidates []*ScheduledScript) *ScheduledScript {
+	return candidates[0]
+}
+
+// RandomPolicy runs a random script each step. With a fixed seed the interleaving is reproducible, so tests can try
+// many different orderings of the same scripts and replay any that fail.
+type RandomPolicy struct {
+	Random *rand.Rand
+}
+
+// NewRandomPolicy creates a random policy from a seed
+func NewRandomPolicy(seed int64) *RandomPolicy {
+	return &RandomPolicy{Random: rand.New(rand.NewSource(seed))}
+}
+
+// Select chooses a random candidate
+func (policy *RandomPolicy) Select(candidates []*ScheduledScript) *ScheduledScript {
+	return candidates[policy.Random.Intn(len(candidates))]
+}
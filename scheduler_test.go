@@ -0,0 +1,187 @@
+package robolang
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchedulerPreemption(t *testing.T) {
+	var log []string
+	var events []*TraceEvent
+	scheduler := NewScheduler(nil)
+	show := newTestScript(t, "say(text='show1')\nsay(text='show2')\nsay(text='show3')", &log)
+	show.Tracer = TracerFunc(func(event *TraceEvent) {
+		if event.Kind == TracePreempted {
+			events = append(events, event)
+		}
+	})
+	showEntry := addScheduledScript(t, scheduler, "show", show, 1)
+	battery := addScheduledScript(t, scheduler, "battery", newTestScript(t, "waitForInput()\nsay(text='battery')", &log), 10)
+
+	for len(log) < 2 {
+		if scheduler.Step() == nil {
+			t.Fatalf("Scheduler stopped early, log: %v", log)
+		}
+	}
+	checkLog(t, log, "wait,show1")
+	if err := battery.Resume("low"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	scheduler.Run()
+	checkLog(t, log, "wait,show1,input:low,battery,show2,show3")
+
+	if showEntry.Preempted != 1 {
+		t.Errorf("Unexpected preemptions: expected 1, got %d", showEntry.Preempted)
+	}
+	if len(events) != 1 || events[0].Message != "Preempted by 'battery'" || events[0].Attributes["by"] != "battery" {
+		t.Errorf("Unexpected trace events: %v", events)
+	}
+	for _, entry := range scheduler.Scripts {
+		if entry.Script.State != ScriptStateFinished {
+			t.Errorf("Unexpected state for '%s': expected %s, actual %s", entry.Name, ScriptStateFinished.String(), entry.Script.State.String())
+		}
+	}
+}
+
+func TestSchedulerPolicies(t *testing.T) {
+	tests := []struct {
+		policy   SchedulingPolicy
+		expected string
+	}{
+		{nil, "a1,a2,b1,c1,b2,c2"},
+		{PriorityPolicy{}, "a1,a2,b1,c1,b2,c2"},
+		{RoundRobinPolicy{}, "a1,b1,c1,a2,b2,c2"},
+		{SchedulingPolicyFunc(func(candidates []*ScheduledScript) *ScheduledScript {
+			return candidates[len(candidates)-1]
+		}), "c1,c2,b1,b2,a1,a2"},
+	}
+
+	for _, test := range tests {
+		var log []string
+		scheduler := NewScheduler(test.policy)
+		addScheduledScript(t, scheduler, "a", newTestScript(t, "say(text='a1')\nsay(text='a2')", &log), 2)
+		addScheduledScript(t, scheduler, "b", newTestScript(t, "say(text='b1')\nsay(text='b2')", &log), 1)
+		addScheduledScript(t, scheduler, "c", newTestScript(t, "say(text='c1')\nsay(text='c2')", &log), 1)
+		scheduler.Run()
+		checkLog(t, log, test.expected)
+	}
+}
+
+func TestSchedulerRandomPolicy(t *testing.T) {
+	run := func(seed int64) string {
+		var log []string
+		scheduler := NewScheduler(NewRandomPolicy(seed))
+		for _, name := range []string{"a", "b", "c"} {
+			addScheduledScript(t, scheduler, name, newTestScript(t, "say(text='"+name+"1')\nsay(text='"+name+"2')\nsay(text='"+name+"3')", &log), 0)
+		}
+		scheduler.Run()
+		return strings.Join(log, ",")
+	}
+
+	first := run(42)
+	for count := 0; count < 5; count++ {
+		if next := run(42); next != first {
+			t.Fatalf("Interleaving is not reproducible: [%s] then [%s]", first, next)
+		}
+	}
+	different := false
+	for seed := int64(0); seed < 10 && !different; seed++ {
+		different = run(seed) != first
+	}
+	if !different {
+		t.Errorf("Random policy always gave the same interleaving [%s]", first)
+	}
+}
+
+func TestSchedulerTimers(t *testing.T) {
+	var log []string
+	clock := NewManualClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler := NewScheduler(nil)
+	scheduler.Clock = clock
+	addScheduledScript(t, scheduler, "idle", newTestScript(t, "withTimeout(duration=1s):\n  waitForInput()\nonTimeout():\n  say(text='idle')", &log), 0)
+	monitor := addScheduledScript(t, scheduler, "monitor", newTestScript(t, "withTimeout(duration=2s):\n  waitForInput()\nonTimeout():\n  say(text='monitor')", &log), 1)
+
+	scheduler.Run()
+	checkLog(t, log, "wait,wait")
+	deadline, ok := scheduler.NextDeadline()
+	if !ok || !deadline.Equal(clock.Now().Add(time.Second)) {
+		t.Fatalf("Unexpected deadline: %v", deadline)
+	}
+
+	clock.Advance(time.Second)
+	scheduler.Run()
+	checkLog(t, log, "wait,wait,idle")
+	clock.Advance(time.Second)
+	scheduler.Run()
+	checkLog(t, log, "wait,wait,idle,monitor")
+	if monitor.Script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), monitor.Script.State.String())
+	}
+}
+
+func TestSchedulerCancelAndErrors(t *testing.T) {
+	var log []string
+	scheduler := NewScheduler(nil)
+	waiting := addScheduledScript(t, scheduler, "waiting", newTestScript(t, "try():\n  waitForInput()\nfinally():\n  say(text='finally')", &log), 0)
+	failing := addScheduledScript(t, scheduler, "failing", newTestScript(t, "fail(message='Broken')", &log), 0)
+	scheduler.Run()
+
+	if err := failing.Err(); err == nil || err.Error() != "Broken at line 0, pos 0" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := waiting.Err(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := waiting.Cancel(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait")
+	scheduler.Run()
+	checkLog(t, log, "wait,finally")
+	if waiting.Script.State != ScriptStateCancelled {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateCancelled.String(), waiting.Script.State.String())
+	}
+}
+
+func TestSchedulerBudget(t *testing.T) {
+	var log []string
+	scheduler := NewScheduler(nil)
+	looping := newBehaviourScript(t, "repeatUntilFail():\n  isTrue(value='yes')", &log)
+	looping.Budget.Instructions = 100
+	entry := addScheduledScript(t, scheduler, "looping", looping, 0)
+	scheduler.Run()
+	if err := entry.Err(); !errors.Is(err, ErrInstructionBudgetExceeded) {
+		t.Errorf("Unexpected error: expected %v, got %v", ErrInstructionBudgetExceeded, err)
+	}
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	var log []string
+	scheduler := NewScheduler(nil)
+	addScheduledScript(t, scheduler, "a", newTestScript(t, "say(text='a')", &log), 0)
+	if _, err := scheduler.Add("a", newTestScript(t, "say(text='b')", &log), 0); err == nil || err.Error() != "A script called 'a' has already been added" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	started := newTestScript(t, "say(text='c')", &log)
+	if err := started.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := scheduler.Add("c", started, 0); err == nil || err.Error() != "Script 'c' has already been started" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := scheduler.Get("a").Script.Run(nil); err != ErrScriptNotRunning {
+		t.Errorf("Unexpected error: expected %v, got %v", ErrScriptNotRunning, err)
+	}
+}
+
+func addScheduledScript(t *testing.T, scheduler *Scheduler, name string, script *Script, priority int) *ScheduledScript {
+	t.Helper()
+	entry, err := scheduler.Add(name, script, priority)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return entry
+}
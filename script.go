@@ -1,76 +1,361 @@
 package robolang
 
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
 // Script defines the execution environment for a script
 type Script struct {
-	Nodes []*Node
-	State ScriptState
+	AuditLog     *AuditLog
+	Budget       Budget
+	Channels     *Channels
+	Clock        Clock
+	CurrentState string
+	Functions    *FunctionTable
+	Locks        *LockManager
+	Nodes        []*Node
+	Random       *rand.Rand
+	State        ScriptState
+	Tracer       Tracer
+	Variables    *VariableTable
 
-	current *scriptNode
-	nodeMap map[int]*scriptNode
+	cancelled bool
+	ctx       context.Context
+	current   *Node
+	err       error
+	events    *Subscription
+	handlers  []*eventHandler
+	machine   *machineFrame
+	main      *task
+	nextTask  int
+	queued    []*eventHandler
+	spawned   map[string]*spawnedTask
+	states    []*machineState
+	statuses  map[*Node]BehaviourStatus
+	stopped   error
+	tasks     []*task
+	timers    []*timer
+	usage     struct {
+		paused  time.Time
+		started time.Time
+		steps   int
+	}
+	wake     func()
+	yield    func() bool
+	yielding bool
 }
 
-// Start begins executing the script
+var (
+	// ErrScriptNotRunning is returned when trying to interact with a script that is not running
+	ErrScriptNotRunning = errors.New("Script is not running")
+)
+
+// Start begins executing the script. It returns when the script has finished, failed, is waiting for something
+// external (e.g. input or an event), or has given up control part way through a loop so the host can carry on with
+// Poll.
 func (s *Script) Start() error {
-	s.nodeMap = map[int]*scriptNode{}
-	s.initialiseNodes(&s.Nodes, 0, nil)
-	first, ok := s.nodeMap[0]
-	if !ok {
-		s.State = ScriptStateFinished
+	if s.State != ScriptStatePending {
+		return ErrScriptNotRunning
+	}
+	if s.Variables == nil {
+		s.Variables = NewVariableTable()
+	}
+
+	var main []*Node
+	for _, node := range s.Nodes {
+		if node.Type != NodeFunction {
+			main = append(main, node)
+			continue
+		}
+		switch node.Token.Value {
+		case handlerFunction:
+			handler, err := newEventHandler(node)
+			if err != nil {
+				return s.fail(err)
+			}
+			s.handlers = append(s.handlers, handler)
+		case stateFunction:
+			if err := s.addState(node); err != nil {
+				return s.fail(err)
+			}
+		default:
+			main = append(main, node)
+		}
+	}
+
+	s.State = ScriptStateWaiting
+	if len(s.states) > 0 {
+		s.machine = &machineFrame{main: main}
+		s.main = s.startTask(s.machine, 0)
+	} else {
+		s.main = s.startTask(&blockFrame{nodes: main, topLevel: true}, 0)
+	}
+	return s.run()
+}
+
+// Resume passes input to a function that is waiting for it and continues executing the script. If several functions
+// are waiting, the input goes to the one in the highest priority task and the others carry on waiting.
+func (s *Script) Resume(input string) error {
+	if s.State != ScriptStateWaiting && s.State != ScriptStatePaused {
+		return ErrScriptNotRunning
+	}
+	s.resume(input, nil)
+	return s.run()
+}
+
+// resume passes input (and the event it came from, if any) to the highest priority function that is waiting for it.
+func (s *Script) resume(input string, event *Event) {
+	var waiting *task
+	for _, t := range s.tasks {
+		if t.waitingCall() != nil && (waiting == nil || t.priority > waiting.priority) {
+			waiting = t
+		}
+	}
+	if waiting == nil {
+		return
+	}
+	call := waiting.waitingCall()
+	call.Event, call.Input = event, input
+	call.resume()
+	waiting.waiting = false
+}
+
+// Cancel stops the script. Any finally blocks that are active are run before the script is cancelled, so if one of
+// them waits the script needs to be resumed before it is fully cancelled.
+func (s *Script) Cancel() error {
+	switch {
+	case s.State == ScriptStatePending:
+		s.State = ScriptStateCancelled
 		return nil
+	case (s.State != ScriptStateWaiting && s.State != ScriptStatePaused) || s.cancelled:
+		return ErrScriptNotRunning
 	}
 
-	s.current = first
-	return s.executeLoop()
+	s.cancelled, s.queued = true, nil
+	for _, t := range s.tasks {
+		s.cancelTask(t)
+	}
+	return s.run()
+}
+
+// CurrentNode returns the node that the script executed most recently.
+func (s *Script) CurrentNode() *Node {
+	return s.current
 }
 
-func (s *Script) executeLoop() error {
-	err := s.executeNode()
-	if err != nil {
-		s.State = ScriptStateFailed
-		return err
+// Snapshot captures the current state of the script, including the state machine, variables and any messages
+// waiting for it on its channels (while it is still running).
+func (s *Script) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		CurrentState: s.CurrentState,
+		State:        s.State,
+		StateText:    s.State.String(),
+		Variables:    map[string]string{},
+	}
+	stopped := s.State == ScriptStateFinished || s.State == ScriptStateFailed || s.State == ScriptStateCancelled
+	if s.Channels != nil && !stopped {
+		if pending := s.Channels.Pending(s); len(pending) > 0 {
+			snapshot.Messages = pending
+		}
 	}
+	if s.Variables != nil {
+		for name, variable := range s.Variables.Variables {
+			if variable.Value != nil {
+				snapshot.Variables[name] = *variable.Value
+			}
+			for field, value := range variable.Fields {
+				snapshot.Variables[name+"."+field] = value
+			}
+		}
+	}
+	return snapshot
+}
 
-	// next := s.current.next
+// Snapshot is a point-in-time view of a script
+type Snapshot struct {
+	CurrentState string              `json:"currentState,omitempty"`
+	Messages     map[string][]string `json:"messages,omitempty"`
+	State        ScriptState         `json:"-"`
+	StateText    string              `json:"state"`
+	Variables    map[string]string   `json:"variables"`
+}
 
-	return nil
+// fail stops the script with an error.
+func (s *Script) fail(err error) error {
+	s.State, s.err = ScriptStateFailed, err
+	s.release()
+	return err
 }
 
-func (s *Script) executeNode() error {
+// release frees anything the script was using in objects shared with other scripts once it has stopped.
+func (s *Script) release() {
+	if s.Channels != nil {
+		s.Channels.forget(s)
+	}
+}
+
+// run executes the tasks until they have all finished or are waiting, firing any timers that expire along the way.
+func (s *Script) run() error {
+	if !s.usage.paused.IsZero() {
+		// Carry on with the same run, without counting the time spent paused
+		s.usage.started = s.usage.started.Add(s.now().Sub(s.usage.paused))
+		s.usage.paused = time.Time{}
+	} else {
+		s.usage.started, s.usage.steps = s.now(), 0
+	}
+	s.State = ScriptStateRunning
+	if len(s.tasks) > 0 && s.stopped == nil {
+		if err := s.contextError(s.tasks[0]); err != nil {
+			s.stop(err)
+		}
+	}
+	for {
+		// Without a host to decide when to yield (e.g. an Execution), loops give up control after each pass
+		yielding := s.yielding && s.yield == nil
+		s.yielding = false
+		if yielding || (s.yield != nil && !s.yield()) {
+			s.State, s.usage.paused = ScriptStatePaused, s.now()
+			return nil
+		}
+		s.fireTimers()
+		s.checkConditions()
+		if s.events != nil {
+			s.deliverEvents()
+		}
+		if !s.step() {
+			break
+		}
+	}
+
+	switch {
+	case s.err != nil:
+		return s.fail(s.err)
+	case s.stopped != nil:
+		// The context has been cancelled, so the finally blocks cannot wait for anything
+		s.abort(s.stopped)
+		return s.fail(s.stopped)
+	case len(s.tasks) > 0:
+		s.State = ScriptStateWaiting
+	case s.cancelled:
+		s.State = ScriptStateCancelled
+		s.release()
+	case s.unjoinedError() != nil:
+		return s.fail(s.unjoinedError())
+	case s.main.done:
+		s.State = ScriptStateFinished
+		s.release()
+	}
 	return nil
 }
 
-func (s *Script) initialiseNodes(nodes *[]*Node, id int, parent *scriptNode) (*scriptNode, int) {
-	var last, first *scriptNode
-	for _, node := range *nodes {
-		this := &scriptNode{
-			id:     id,
-			node:   *node,
-			parent: parent,
+// step executes a single node boundary in the next runnable task, it returns false if there are no runnable tasks.
+func (s *Script) step() bool {
+	if s.main.done && !s.handlerRunning() {
+		// There is no top-level block left to start the queued handlers, so they start as soon as nothing else is
+		// handling an event
+		s.startQueuedHandlers()
+	}
+	t := s.nextRunnable()
+	if t == nil {
+		return false
+	}
+	if err := s.checkBudget(t); err != nil {
+		s.abort(err)
+		return false
+	}
+	s.current = t.frames[len(t.frames)-1].current()
+
+	t.step()
+	if t.done {
+		s.removeTask(t)
+		if t.onDone != nil {
+			t.onDone(t)
+		} else if t.result != nil && !t.cancelled {
+			s.err = t.result
+			return false
 		}
-		if first == nil {
-			first = this
+	}
+	return true
+}
+
+// nextRunnable selects the highest priority task that can run, sharing time between tasks with the same priority.
+func (s *Script) nextRunnable() *task {
+	blocking := -1
+	for _, t := range s.tasks {
+		if t.handler != nil && t.priority > blocking {
+			blocking = t.priority
+		}
+	}
+
+	var next *task
+	for count := 0; count < len(s.tasks); count++ {
+		t := s.tasks[(s.nextTask+count)%len(s.tasks)]
+		if t.waiting || t.blocked || t.priority < blocking {
+			continue
 		}
-		id++
-		s.nodeMap[id] = this
-		if last != nil {
-			last.next = this
+		if next == nil || t.priority > next.priority {
+			next = t
 		}
-		last = this
+	}
+	if next != nil {
+		for pos, t := range s.tasks {
+			if t == next {
+				s.nextTask = pos + 1
+			}
+		}
+	}
+	return next
+}
 
-		this.firstArg, id = s.initialiseNodes(&this.node.Args, id, this)
-		this.firstChild, id = s.initialiseNodes(&this.node.Children, id, this)
+// checkConditions unblocks any tasks whose wait conditions (e.g. a resource being granted) have been satisfied.
+func (s *Script) checkConditions() {
+	for _, t := range s.tasks {
+		if t.condition != nil && t.blocked && t.condition.ready() {
+			t.blocked = false
+		}
+	}
+}
+
+// conditionsReady checks whether any blocked tasks can carry on because their wait conditions have been satisfied.
+func (s *Script) conditionsReady() bool {
+	for _, t := range s.tasks {
+		if t.condition != nil && t.blocked && t.condition.ready() {
+			return true
+		}
 	}
+	return false
+}
 
-	return first, id
+// cancelTask stops a task before it has finished. The task carries on running until all of its frames have been
+// discarded, which gives any finally blocks a chance to run.
+func (s *Script) cancelTask(t *task) {
+	t.cancelled = true
+	t.unwindTo(nil)
 }
 
-type scriptNode struct {
-	firstArg   *scriptNode
-	firstChild *scriptNode
-	id         int
-	node       Node
-	next       *scriptNode
-	parent     *scriptNode
+func (s *Script) removeTask(t *task) {
+	for pos, other := range s.tasks {
+		if other == t {
+			s.tasks = append(s.tasks[:pos], s.tasks[pos+1:]...)
+			if s.nextTask > pos {
+				s.nextTask--
+			}
+			return
+		}
+	}
+}
+
+func (s *Script) startTask(f frame, priority int) *task {
+	t := &task{
+		priority: priority,
+		script:   s,
+	}
+	t.push(f)
+	s.tasks = append(s.tasks, t)
+	return t
 }
 
 // ScriptState defines the current state of the script
@@ -90,4 +375,14 @@ const (
 
 	// ScriptStateFailed means the script has failed at some point in its execution
 	ScriptStateFailed
+
+	// ScriptStateCancelled means the script was cancelled before it finished
+	ScriptStateCancelled
+
+	// ScriptStateRunning means the script is executing
+	ScriptStateRunning
+
+	// ScriptStatePaused means the script has been paused, or has given up control part way through a loop, and will not
+	// continue until it is resumed or polled
+	ScriptStatePaused
 )
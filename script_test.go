@@ -1,6 +1,10 @@
 package robolang
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+)
 
 func TestFromParseResult(t *testing.T) {
 	parser := NewParser("clear()")
@@ -18,3 +22,116 @@ func TestStartTerminatesWithNoNodes(t *testing.T) {
 		t.Errorf("Unexpected script state: expected %s, actual %s", expected.String(), script.State.String())
 	}
 }
+
+func TestScriptRunsNodesInOrder(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "say(text='one')\nsay(text='two')\nwaitForInput():\n  say(text='three')", &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "one,two,wait")
+	if script.State != ScriptStateWaiting {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateWaiting.String(), script.State.String())
+	}
+
+	if err := script.Resume("go"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "one,two,wait,input:go,three")
+	if script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), script.State.String())
+	}
+}
+
+func TestScriptFailures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"unknown()", "Unknown function 'unknown' at line 0, pos 0"},
+		{"say(text='one')\nfail(message='broken')\nsay(text='two')", "broken at line 1, pos 0"},
+		{"say()", "Missing argument 'text' at line 0, pos 0"},
+		{"say(text='{&missing}')", "Unknown variable 'missing' at line 0, pos 10"},
+	}
+	for _, test := range tests {
+		var log []string
+		script := newTestScript(t, test.input, &log)
+		err := script.Start()
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Unexpected error for `%s`: expected [%s], got [%v]", test.input, test.expected, err)
+		}
+		if script.State != ScriptStateFailed {
+			t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFailed.String(), script.State.String())
+		}
+	}
+}
+
+func TestScriptVariables(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "set(variable=&name,value='Robo')\nsay(text='Hello {&name}')\nsay(text=&name)", &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "Hello Robo,Robo")
+}
+
+func TestScriptCannotStartTwice(t *testing.T) {
+	script := &Script{}
+	script.Start()
+	if err := script.Start(); err != ErrScriptNotRunning {
+		t.Errorf("Unexpected error: expected %v, got %v", ErrScriptNotRunning, err)
+	}
+	if err := script.Resume(""); err != ErrScriptNotRunning {
+		t.Errorf("Unexpected error: expected %v, got %v", ErrScriptNotRunning, err)
+	}
+}
+
+// newTestScript parses a script and adds some simple functions that record what they do in log.
+func newTestScript(t *testing.T, input string, log *[]string) *Script {
+	result := NewParser(input).Parse()
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors while parsing `%s`: [%v]", input, result.Errors)
+	}
+	script := result.Script()
+	script.Functions = NewFunctionTable(
+		NewFunction("say").SetFunction(FunctionFunc(func(call *Call) error {
+			text, err := call.Value("text")
+			*log = append(*log, text)
+			return err
+		})),
+		NewFunction("set").SetFunction(FunctionFunc(func(call *Call) error {
+			value, err := call.Value("value")
+			if err != nil {
+				return err
+			}
+			return call.Set("variable", value)
+		})),
+		NewFunction("fail").SetFunction(FunctionFunc(func(call *Call) error {
+			message, _ := call.Value("message")
+			return errors.New(message)
+		})),
+		NewFunction("waitForInput").SetFunction(&waitForInput{log: log}))
+	return script
+}
+
+type waitForInput struct {
+	log *[]string
+}
+
+func (fn *waitForInput) Start(call *Call) error {
+	*fn.log = append(*fn.log, "wait")
+	call.Wait()
+	return nil
+}
+
+func (fn *waitForInput) Resume(call *Call) error {
+	*fn.log = append(*fn.log, "input:"+call.Input)
+	return nil
+}
+
+func checkLog(t *testing.T, log []string, expected string) {
+	t.Helper()
+	if actual := strings.Join(log, ","); actual != expected {
+		t.Errorf("Unexpected log: expected [%s], got [%s]", expected, actual)
+	}
+}
@@ -0,0 +1,148 @@
+package robolang
+
+import "strconv"
+
+const (
+	cancelFunction = "cancel"
+	joinFunction   = "join"
+	spawnFunction  = "spawn"
+)
+
+// spawnedTask is a background sequence started by `spawn(handle=&name):`. The handle variable holds an ID that can be
+// passed to `join(handle=&name)` to wait for the sequence to finish, or `cancel(handle=&name)` to stop it.
+type spawnedTask struct {
+	id      string
+	joined  bool
+	node    *Node
+	number  int
+	result  error
+	task    *task
+	waiters []*task
+}
+
+// spawnFrame starts a background sequence and carries on straight away.
+type spawnFrame struct {
+	node *Node
+}
+
+func (f *spawnFrame) current() *Node {
+	return f.node
+}
+
+func (f *spawnFrame) step(t *task) {
+	for _, arg := range f.node.Args {
+		if arg.Token.Value != "handle" {
+			t.pop(newRuntimeError(arg, "Unknown %s argument '%s'", spawnFunction, arg.Token.Value))
+			return
+		}
+	}
+	handle := newCall(t.script, f.node).Arg("handle")
+	if handle != nil && handle.Type != NodeVariable {
+		t.pop(newRuntimeError(handle, "Argument 'handle' must be a variable"))
+		return
+	}
+
+	s := t.script
+	spawned := &spawnedTask{
+		id:     "task-" + strconv.Itoa(len(s.spawned)+1),
+		node:   f.node,
+		number: len(s.spawned) + 1,
+	}
+	spawned.task = s.startTask(&blockFrame{nodes: f.node.Children}, t.priority)
+	spawned.task.onDone = spawned.finished
+	if s.spawned == nil {
+		s.spawned = map[string]*spawnedTask{}
+	}
+	s.spawned[spawned.id] = spawned
+	if handle != nil {
+		s.setVariable(handle.Token.Value, spawned.id)
+	}
+	t.pop(nil)
+}
+
+func (spawned *spawnedTask) finished(t *task) {
+	spawned.result = t.result
+	if t.cancelled {
+		err := newRuntimeError(spawned.node, "The spawned sequence was cancelled")
+		err.Code = ErrorCodeCancelled
+		spawned.result = err
+	}
+	for _, waiter := range spawned.waiters {
+		waiter.blocked = false
+	}
+	spawned.waiters = nil
+}
+
+// handleFrame executes join and cancel, which both act on the spawned sequence for a handle.
+type handleFrame struct {
+	node    *Node
+	spawned *spawnedTask
+}
+
+func (f *handleFrame) current() *Node {
+	return f.node
+}
+
+func (f *handleFrame) step(t *task) {
+	if f.spawned == nil {
+		id, err := newCall(t.script, f.node).Value("handle")
+		if err != nil {
+			t.pop(wrapRuntimeError(f.node, err))
+			return
+		}
+		spawned, ok := t.script.spawned[id]
+		if !ok {
+			t.pop(newRuntimeError(f.node, "Unknown spawned sequence '%s'", id))
+			return
+		}
+		f.spawned = spawned
+
+		if f.node.Token.Value == cancelFunction {
+			if !spawned.task.done {
+				t.script.cancelTask(spawned.task)
+			}
+			t.pop(nil)
+			return
+		}
+	}
+
+	// Joining
+	if !f.spawned.task.done {
+		f.spawned.waiters = append(f.spawned.waiters, t)
+		t.blocked = true
+		return
+	}
+	f.spawned.joined = true
+	t.pop(f.spawned.result)
+}
+
+// cancel stops waiting for the spawned sequence when the join is abandoned.
+func (f *handleFrame) cancel(t *task) bool {
+	if f.spawned == nil {
+		return false
+	}
+	for pos, waiter := range f.spawned.waiters {
+		if waiter == t {
+			f.spawned.waiters = append(f.spawned.waiters[:pos], f.spawned.waiters[pos+1:]...)
+			break
+		}
+	}
+	return false
+}
+
+// unjoinedError returns the error from the first spawned sequence that failed without anything joining it.
+func (s *Script) unjoinedError() error {
+	var first *spawnedTask
+	for _, spawned := range s.spawned {
+		if spawned.joined || spawned.result == nil || spawned.task.cancelled {
+			continue
+		}
+		if first == nil || spawned.number < first.number {
+			first = spawned
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	return first.result
+}
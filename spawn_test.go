@@ -0,0 +1,86 @@
+package robolang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpawn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"spawn(handle=&talk):\n  say(text='a')\n  say(text='b')\nsay(text='c')\njoin(handle=&talk)\nsay(text='d')", "a,c,b,d", ""},
+		{"spawn():\n  say(text='a')\nsay(text='b')", "a,b", ""},
+		{"spawn(handle=&talk):\n  waitForInput()\n  say(text='a')\ncancel(handle=&talk)\nsay(text='b')", "wait,b", ""},
+		{"spawn(handle=&talk):\n  waitForInput()\ncancel(handle=&talk)\ntry():\n  join(handle=&talk)\ncatch(error=&err):\n  say(text='{&err.code}')", "wait,cancelled", ""},
+		{"spawn(handle=&talk):\n  fail(message='broken')\ntry():\n  join(handle=&talk)\ncatch(error=&err):\n  say(text='{&err}')", "broken", ""},
+		{"spawn():\n  fail(message='broken')\nsay(text='a')", "a", "broken at line 1, pos 2"},
+		{"join(handle='task-9')", "", "Unknown spawned sequence 'task-9' at line 0, pos 0"},
+		{"spawn(handle='x'):\n  say(text='a')", "", "Argument 'handle' must be a variable at line 0, pos 13"},
+		{"spawn(name=&x):\n  say(text='a')", "", "Unknown spawn argument 'name' at line 0, pos 6"},
+	}
+	for _, test := range tests {
+		var log []string
+		script := newTestScript(t, test.input, &log)
+		err := script.Start()
+		if script.State == ScriptStateWaiting {
+			err = script.Resume("")
+		}
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("Unexpected error for `%s`: expected [%s], got [%v]", test.input, test.err, err)
+		}
+		if actual := strings.Join(log, ","); actual != test.expected {
+			t.Errorf("Unexpected log for `%s`: expected [%s], got [%s]", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestSpawnInterleaves(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "spawn(handle=&talk):\n  say(text='hello')\n  say(text='there')\nsay(text='moving')\nsay(text='still moving')\njoin(handle=&talk)", &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The tasks take turns, switching after each step
+	checkLog(t, log, "hello,moving,there,still moving")
+}
+
+func TestSpawnJoinWaits(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "spawn(handle=&talk):\n  waitForInput()\njoin(handle=&talk)\nsay(text='joined')", &log)
+	script.Start()
+	checkLog(t, log, "wait")
+	script.Resume("x")
+	checkLog(t, log, "wait,input:x,joined")
+	if script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), script.State.String())
+	}
+}
+
+func TestParallelJoinPolicies(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"parallel(join='all'):\n  isTrue(value='no')\n  say(text='a')\n  say(text='b')", "a,b", "'isTrue' failed at line 1, pos 2"},
+		{"parallel(join='firstFailure'):\n  isTrue(value='no')\n  say(text='a')\n  waitForInput()", "a,wait", "'isTrue' failed at line 1, pos 2"},
+		{"parallel(join='any'):\n  waitForInput()\n  say(text='a')\nsay(text='b')", "wait,a,b", ""},
+		{"parallel(join='any'):\n  isTrue(value='no')\n  isTrue(value='no')", "", "Only 0 of the children of 'parallel' succeeded, 1 needed at line 0, pos 0"},
+		{"parallel(join='some'):\n  say(text='a')", "", "join must be 'all', 'any' or 'firstFailure', found 'some' at line 0, pos 14"},
+		{"parallel(join='any', successThreshold=1):\n  say(text='a')", "", "join and successThreshold cannot be used together at line 0, pos 14"},
+	}
+	for _, test := range tests {
+		var log []string
+		script := newBehaviourScript(t, test.input, &log)
+		err := script.Start()
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("Unexpected error for `%s`: expected [%s], got [%v]", test.input, test.err, err)
+		}
+		if actual := strings.Join(log, ","); actual != test.expected {
+			t.Errorf("Unexpected log for `%s`: expected [%s], got [%s]", test.input, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package robolang
+
+const (
+	gotoFunction    = "goto"
+	onEnterFunction = "onEnter"
+	onExitFunction  = "onExit"
+	stateFunction   = "state"
+)
+
+// machineState is a `state(name='idle'):` block in a state machine. For example:
+//
+//	state(name='idle'):
+//	  onEnter():
+//	    say(text='Waiting')
+//	  waitForPerson():
+//	    goto(state='greeting')
+//
+// The onEnter and onExit blocks are optional, everything else in the block is the body of the state.
+type machineState struct {
+	body    []*Node
+	name    string
+	node    *Node
+	onEnter []*Node
+	onExit  []*Node
+}
+
+func newMachineState(node *Node) (*machineState, error) {
+	state := &machineState{node: node}
+	for _, arg := range node.Args {
+		if arg.Token.Value != "name" {
+			return nil, newRuntimeError(arg, "Unknown state argument '%s'", arg.Token.Value)
+		}
+		if len(arg.Children) != 1 || arg.Children[0].Type != NodeConstant {
+			return nil, newRuntimeError(arg, "State argument 'name' must be a constant")
+		}
+		state.name = arg.Children[0].Token.Value
+	}
+	if state.name == "" {
+		return nil, newRuntimeError(node, "State is missing the name argument")
+	}
+
+	for _, child := range node.Children {
+		if child.Type != NodeFunction {
+			state.body = append(state.body, child)
+			continue
+		}
+		switch child.Token.Value {
+		case onEnterFunction:
+			if state.onEnter != nil {
+				return nil, newRuntimeError(child, "State '%s' already has an onEnter block", state.name)
+			}
+			state.onEnter = append([]*Node{}, child.Children...)
+		case onExitFunction:
+			if state.onExit != nil {
+				return nil, newRuntimeError(child, "State '%s' already has an onExit block", state.name)
+			}
+			state.onExit = append([]*Node{}, child.Children...)
+		default:
+			state.body = append(state.body, child)
+		}
+	}
+	return state, nil
+}
+
+// addState adds a top-level state to the script's state machine.
+func (s *Script) addState(node *Node) error {
+	state, err := newMachineState(node)
+	if err != nil {
+		return err
+	}
+	for _, other := range s.states {
+		if other.name == state.name {
+			return newRuntimeError(node, "State '%s' has already been declared", state.name)
+		}
+	}
+	s.states = append(s.states, state)
+	return nil
+}
+
+// gotoState asks the state machine to change to a new state. The main task is unwound back to the state machine,
+// which then runs the onExit block of the current state and the onEnter block of the new state.
+func (s *Script) gotoState(node *Node, name string) error {
+	var target *machineState
+	for _, state := range s.states {
+		if state.name == name {
+			target = state
+		}
+	}
+	if target == nil {
+		return newRuntimeError(node, "Unknown state '%s'", name)
+	}
+	if s.machine == nil || s.main.done || s.cancelled {
+		return newRuntimeError(node, "The state machine is not running")
+	}
+	if s.machine.phase == machineExiting {
+		return newRuntimeError(node, "Cannot change state while leaving state '%s'", s.machine.state.name)
+	}
+	s.machine.next = target
+	s.main.unwindTo(s.machine)
+	return nil
+}
+
+type machinePhase int
+
+const (
+	machineStarting machinePhase = iota
+	machineMain
+	machineEntering
+	machineRunning
+	machineExiting
+)
+
+// machineFrame runs the main sequence of the script, followed by the state machine. The machine starts in the
+// first state declared (unless the main sequence changes state) and finishes when a state's body finishes without
+// changing state.
+type machineFrame struct {
+	main   []*Node
+	next   *machineState
+	phase  machinePhase
+	state  *machineState
+	target *machineState
+}
+
+func (f *machineFrame) current() *Node {
+	if f.state == nil {
+		return nil
+	}
+	return f.state.node
+}
+
+func (f *machineFrame) step(t *task) {
+	if t.result != nil {
+		t.pop(t.result)
+		return
+	}
+
+	if f.next != nil {
+		f.target, f.next = f.next, nil
+		if f.state == nil {
+			f.enter(t)
+			return
+		}
+		f.phase = machineExiting
+		t.push(&blockFrame{nodes: f.state.onExit})
+		return
+	}
+
+	switch f.phase {
+	case machineStarting:
+		f.phase = machineMain
+		t.push(&blockFrame{nodes: f.main, topLevel: true})
+	case machineMain:
+		f.target = t.script.states[0]
+		f.enter(t)
+	case machineEntering:
+		f.phase = machineRunning
+		t.push(&blockFrame{nodes: f.state.body, topLevel: true})
+	case machineExiting:
+		f.enter(t)
+	default:
+		t.pop(nil)
+	}
+}
+
+func (f *machineFrame) enter(t *task) {
+	f.state, f.target = f.target, nil
+	f.phase = machineEntering
+	t.script.CurrentState = f.state.name
+	t.script.trace(TraceStateChanged, f.state.node, map[string]string{"state": f.state.name}, "Entering state '%s'", f.state.name)
+	t.script.audit(f.state.node, "Entered state '%s'", f.state.name)
+	t.push(&blockFrame{nodes: f.state.onEnter})
+}
+
+// gotoFrame executes a `goto(state='name')` transition.
+type gotoFrame struct {
+	node *Node
+}
+
+func (f *gotoFrame) current() *Node {
+	return f.node
+}
+
+func (f *gotoFrame) step(t *task) {
+	name, err := newCall(t.script, f.node).Value("state")
+	if err == nil {
+		err = t.script.gotoState(f.node, name)
+	}
+	if err != nil {
+		t.pop(wrapRuntimeError(f.node, err))
+		return
+	}
+	if t.unwind == nil {
+		// The transition happens in the main task, so the handler carries on
+		t.pop(nil)
+	}
+}
@@ -0,0 +1,97 @@
+package robolang
+
+import "testing"
+
+func TestStateMachine(t *testing.T) {
+	var log []string
+	input := "say(text='boot')\n" +
+		"state(name='idle'):\n  onEnter():\n    say(text='enter idle')\n  onExit():\n    say(text='exit idle')\n  waitForInput():\n    goto(state='greeting')\n" +
+		"state(name='greeting'):\n  onEnter():\n    say(text='enter greeting')\n  say(text='hello')\n  goto(state='chatting')\n  say(text='skipped')\n" +
+		"state(name='chatting'):\n  waitForInput():\n    say(text='bye')"
+	script := newTestScript(t, input, &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "boot,enter idle,wait")
+	checkCurrentState(t, script, "idle")
+
+	log = nil
+	script.Resume("")
+	checkLog(t, log, "input:,exit idle,enter greeting,hello,wait")
+	checkCurrentState(t, script, "chatting")
+
+	log = nil
+	script.Resume("")
+	checkLog(t, log, "input:,bye")
+	if script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), script.State.String())
+	}
+	checkCurrentState(t, script, "chatting")
+}
+
+func TestStateMachineHandlerTransition(t *testing.T) {
+	var log []string
+	input := "on(event='person', mode='interrupt'):\n  goto(state='greeting')\n  say(text='handled')\n" +
+		"state(name='idle'):\n  onExit():\n    say(text='exit idle')\n  waitForInput():\n    say(text='input')\n" +
+		"state(name='greeting'):\n  say(text='hello')"
+	script := newTestScript(t, input, &log)
+	script.Start()
+	script.Raise("person")
+	checkLog(t, log, "wait,handled,exit idle,hello")
+	checkCurrentState(t, script, "greeting")
+	if script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), script.State.String())
+	}
+}
+
+func TestStateMachineMainTransition(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "goto(state='second')\nsay(text='skipped')\nstate(name='first'):\n  say(text='first')\nstate(name='second'):\n  say(text='second')", &log)
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "second")
+}
+
+func TestStateMachineErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"state(name='a'):\n  goto(state='b')", "Unknown state 'b' at line 1, pos 2"},
+		{"goto(state='a')", "Unknown state 'a' at line 0, pos 0"},
+		{"state():\n  clear()", "State is missing the name argument at line 0, pos 0"},
+		{"state(name=&name):\n  clear()", "State argument 'name' must be a constant at line 0, pos 6"},
+		{"state(name='a'):\n  clear()\nstate(name='a'):\n  clear()", "State 'a' has already been declared at line 2, pos 0"},
+		{"state(name='a'):\n  onEnter():\n    clear()\n  onEnter():\n    clear()", "State 'a' already has an onEnter block at line 3, pos 2"},
+		{"state(name='a'):\n  onExit():\n    goto(state='b')\n  goto(state='b')\nstate(name='b'):\n  clear()", "Cannot change state while leaving state 'a' at line 2, pos 4"},
+		{"clear():\n  state(name='a'):\n    clear()", "'state' blocks must be at the top level of the script at line 1, pos 2"},
+		{"onEnter():\n  clear()", "'onEnter' blocks must be directly inside a state at line 0, pos 0"},
+	}
+	for _, test := range tests {
+		var log []string
+		script := newTestScript(t, test.input, &log)
+		script.Functions.Functions["clear"] = NewFunction("clear").SetFunction(FunctionFunc(func(call *Call) error { return nil }))
+		err := script.Start()
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Unexpected error for `%s`: expected [%s], got [%v]", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "set(variable=&name,value='Robo')\nstate(name='idle'):\n  waitForInput():\n    say(text='done')", &log)
+	script.Start()
+	snapshot := script.Snapshot()
+	if snapshot.CurrentState != "idle" || snapshot.StateText != "ScriptStateWaiting" || snapshot.Variables["name"] != "Robo" {
+		t.Errorf("Unexpected snapshot: %+v", snapshot)
+	}
+}
+
+func checkCurrentState(t *testing.T, script *Script, expected string) {
+	t.Helper()
+	if script.CurrentState != expected {
+		t.Errorf("Unexpected current state: expected %s, actual %s", expected, script.CurrentState)
+	}
+}
@@ -0,0 +1,199 @@
+package robolang
+
+import (
+	"sort"
+	"strings"
+)
+
+// SyntaxTree is a lossless view of a parsed script: every token from the source, including whitespace and comments,
+// belongs to exactly one syntax node (or to the tree itself when it comes after the last node).
+type SyntaxTree struct {
+	Nodes    []*SyntaxNode
+	Trailing []*Token
+}
+
+// String converts the tree back into the original source.
+func (tree *SyntaxTree) String() string {
+	var buf strings.Builder
+	for _, node := range tree.Nodes {
+		node.write(&buf)
+	}
+	writeTokens(&buf, tree.Trailing)
+	return buf.String()
+}
+
+// SyntaxNode wraps a node with all the tokens that it was parsed from.
+//
+// Leading contains the trivia (whitespace, new lines and comments) before the node, Elements contains the node's own
+// tokens interleaved with its arguments and children, and Trailing contains the trivia after the node up to the end
+// of the line.
+type SyntaxNode struct {
+	Elements []*SyntaxElement
+	Leading  []*Token
+	Node     *Node
+	Trailing []*Token
+}
+
+// String converts the node back into its original source.
+func (n *SyntaxNode) String() string {
+	var buf strings.Builder
+	n.write(&buf)
+	return buf.String()
+}
+
+// Children returns the syntax nodes for the node's arguments and children.
+func (n *SyntaxNode) Children() []*SyntaxNode {
+	var children []*SyntaxNode
+	for _, element := range n.Elements {
+		if element.Node != nil {
+			children = append(children, element.Node)
+		}
+	}
+	return children
+}
+
+func (n *SyntaxNode) write(buf *strings.Builder) {
+	writeTokens(buf, n.Leading)
+	for _, element := range n.Elements {
+		if element.Node != nil {
+			element.Node.write(buf)
+		} else {
+			buf.WriteString(element.Token.Source)
+		}
+	}
+	writeTokens(buf, n.Trailing)
+}
+
+// SyntaxElement is either a token or a nested syntax node.
+type SyntaxElement struct {
+	Node  *SyntaxNode
+	Token *Token
+}
+
+var (
+	triviaTokens = map[TokenType]bool{
+		TokenWhitespace: true,
+		TokenComment:    true,
+		TokenDirective:  true,
+		TokenNewLine:    true,
+	}
+)
+
+type syntaxBuilder struct {
+	index  map[*Token]int
+	pos    int
+	tokens []*Token
+}
+
+func newSyntaxTree(nodes []*Node, tokens []*Token) *SyntaxTree {
+	b := &syntaxBuilder{
+		index:  map[*Token]int{},
+		tokens: tokens,
+	}
+	for pos, tok := range tokens {
+		b.index[tok] = pos
+	}
+	if len(tokens) > 0 && tokens[len(tokens)-1].Type == TokenEOF {
+		b.tokens = tokens[:len(tokens)-1]
+	}
+
+	tree := &SyntaxTree{}
+	for _, node := range b.sourceNodes(nodes) {
+		tree.Nodes = append(tree.Nodes, b.build(node))
+	}
+	tree.Trailing = b.tokens[b.pos:]
+	return tree
+}
+
+func (b *syntaxBuilder) build(node *Node) *SyntaxNode {
+	first, last := b.index[node.Token], b.end(node)
+	sn := &SyntaxNode{
+		Node:    node,
+		Leading: b.take(first),
+	}
+
+	subs := b.sourceNodes(append(append([]*Node{}, node.Args...), node.Children...))
+	for b.pos <= last {
+		if len(subs) > 0 && b.isTrivia(b.pos, b.index[subs[0].Token]) {
+			// The rest of the line after one of the node's own tokens stays with the node
+			for pos := b.pos; pos < b.index[subs[0].Token]; pos++ {
+				if b.tokens[pos].Type == TokenNewLine {
+					for ; b.pos <= pos; b.pos++ {
+						sn.Elements = append(sn.Elements, &SyntaxElement{Token: b.tokens[b.pos]})
+					}
+					break
+				}
+			}
+			sn.Elements = append(sn.Elements, &SyntaxElement{Node: b.build(subs[0])})
+			subs = subs[1:]
+			continue
+		}
+		sn.Elements = append(sn.Elements, &SyntaxElement{Token: b.tokens[b.pos]})
+		b.pos++
+	}
+
+	for b.pos < len(b.tokens) && triviaTokens[b.tokens[b.pos].Type] {
+		sn.Trailing = append(sn.Trailing, b.tokens[b.pos])
+		b.pos++
+		if sn.Trailing[len(sn.Trailing)-1].Type == TokenNewLine {
+			break
+		}
+	}
+	return sn
+}
+
+// end finds the index of the last token that belongs to the node or any of its descendants.
+func (b *syntaxBuilder) end(node *Node) int {
+	end := b.index[node.Token]
+	if pos, ok := b.index[node.last]; ok && pos > end {
+		end = pos
+	}
+	for _, sub := range b.sourceNodes(append(append([]*Node{}, node.Args...), node.Children...)) {
+		if pos := b.end(sub); pos > end {
+			end = pos
+		}
+	}
+	return end
+}
+
+// isTrivia checks whether all the tokens from start up to (but not including) end are trivia.
+func (b *syntaxBuilder) isTrivia(start, end int) bool {
+	if end < start {
+		return false
+	}
+	for pos := start; pos < end; pos++ {
+		if !triviaTokens[b.tokens[pos].Type] {
+			return false
+		}
+	}
+	return true
+}
+
+// sourceNodes filters out any nodes that were not scanned directly from the source (e.g. template segments) and
+// sorts the rest into source order.
+func (b *syntaxBuilder) sourceNodes(nodes []*Node) []*Node {
+	var out []*Node
+	for _, node := range nodes {
+		if pos, ok := b.index[node.Token]; ok && pos >= b.pos && pos < len(b.tokens) {
+			out = append(out, node)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return b.index[out[i].Token] < b.index[out[j].Token]
+	})
+	return out
+}
+
+func (b *syntaxBuilder) take(end int) []*Token {
+	var out []*Token
+	for ; b.pos < end; b.pos++ {
+		out = append(out, b.tokens[b.pos])
+	}
+	return out
+}
+
+func writeTokens(buf *strings.Builder, tokens []*Token) {
+	for _, tok := range tokens {
+		buf.WriteString(tok.Source)
+	}
+}
@@ -0,0 +1,61 @@
+package robolang
+
+import "testing"
+
+func TestSyntaxTreeRoundTrip(t *testing.T) {
+	tests := []string{
+		"",
+		"# just a comment\n",
+		"clear()",
+		"clear()\n",
+		"  say( text = 'hello' ) # greet\n\n\nclear()\n",
+		"## Waits for a button\nwaitForInput():\n  # ignored\n  clear()\n\n  say(text=@hello)\nsay(text='bye')\n",
+		"set(\n  variable=&count,\n  value=30cm,\n)\r\nsay(text='''\n  Hello {&count}\n  ''')",
+		"clear--\nsay(text='unreached')",
+		"say(text='{&name')\nclear()",
+	}
+	for _, input := range tests {
+		result := NewParser(input).Parse()
+		actual := result.SyntaxTree().String()
+		if actual != input {
+			t.Errorf("Syntax tree does not round trip: expected %q, got %q", input, actual)
+		}
+	}
+}
+
+func TestSyntaxTreeTrivia(t *testing.T) {
+	input := "waitForInput():\n  # note\n  clear() # done\n  say(text='hi')\n"
+	tree := NewParser(input).Parse().SyntaxTree()
+	if len(tree.Nodes) != 1 {
+		t.Fatalf("Unexpected number of nodes: expected 1, got %d", len(tree.Nodes))
+	}
+
+	children := tree.Nodes[0].Children()
+	if len(children) != 2 {
+		t.Fatalf("Unexpected number of children: expected 2, got %d", len(children))
+	}
+	tests := []struct {
+		node     *SyntaxNode
+		leading  string
+		trailing string
+		text     string
+	}{
+		{children[0], "  # note\n  ", " # done\n", "  # note\n  clear() # done\n"},
+		{children[1], "  ", "\n", "  say(text='hi')\n"},
+	}
+	for _, test := range tests {
+		leading, trailing := "", ""
+		for _, tok := range test.node.Leading {
+			leading += tok.Source
+		}
+		for _, tok := range test.node.Trailing {
+			trailing += tok.Source
+		}
+		if leading != test.leading || trailing != test.trailing || test.node.String() != test.text {
+			t.Errorf("Unexpected trivia for %s: expected [%q,%q,%q], got [%q,%q,%q]",
+				test.node.Node.Token.Value,
+				test.leading, test.trailing, test.text,
+				leading, trailing, test.node.String())
+		}
+	}
+}
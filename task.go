@@ -0,0 +1,304 @@
+package robolang
+
+// task is a cooperative thread of execution within a script. Each task has a stack of frames, and each step executes
+// the frame at the top of the stack until it reaches the next node boundary.
+type task struct {
+	blocked   bool
+	cancelled bool
+	condition waitCondition
+	done      bool
+	frames    []frame
+	handler   *eventHandler
+	onDone    func(*task)
+	parent    *task
+	priority  int
+	result    error
+	script    *Script
+	unwind    *unwinding
+	waiting   bool
+}
+
+// frame is a single level of execution on a task's stack. When a frame finishes it pops itself off the stack and the
+// result is stored in the task for the frame below to inspect on its next step.
+type frame interface {
+	current() *Node
+	step(t *task)
+}
+
+// cancellableFrame is a frame that needs to clean up (e.g. stop other tasks) when it is discarded before finishing.
+// Returning true from cancel keeps the frame on the stack, so it can run something (e.g. a finally block) first.
+type cancellableFrame interface {
+	frame
+	cancel(t *task) bool
+}
+
+// waitCondition is something that a blocked task is waiting for (e.g. a resource or a message), which can be
+// satisfied by another script.
+type waitCondition interface {
+	ready() bool
+}
+
+// unwinding is a request to discard the frames above target, or all the frames if target is nil.
+type unwinding struct {
+	target frame
+}
+
+func (t *task) pop(err error) {
+	t.frames = t.frames[:len(t.frames)-1]
+	t.result = err
+	if len(t.frames) == 0 {
+		t.done = true
+	}
+}
+
+func (t *task) push(f frame) {
+	t.result = nil
+	t.frames = append(t.frames, f)
+}
+
+func (t *task) step() {
+	if t.unwind != nil {
+		if top := t.frames[len(t.frames)-1]; top != t.unwind.target {
+			t.discard()
+			return
+		}
+		t.unwind, t.result, t.blocked = nil, nil, false
+	}
+	t.frames[len(t.frames)-1].step(t)
+}
+
+// discard removes the top frame without finishing it.
+func (t *task) discard() {
+	top := t.frames[len(t.frames)-1]
+	if f, ok := top.(cancellableFrame); ok && f.cancel(t) {
+		return
+	}
+	t.frames = t.frames[:len(t.frames)-1]
+	if len(t.frames) == 0 {
+		t.done = true
+	}
+}
+
+// unwindTo discards all the frames above target (or every frame if target is nil), cancelling anything they were
+// waiting for.
+func (t *task) unwindTo(target frame) {
+	t.unwind = &unwinding{target: target}
+	t.waiting, t.blocked = false, false
+}
+
+// isAbove checks whether frame a is above frame b on the task's stack. A frame that is not on the stack (e.g. nil
+// when unwinding the whole task) is never above another.
+func (t *task) isAbove(a, b frame) bool {
+	for pos := len(t.frames) - 1; pos >= 0; pos-- {
+		switch t.frames[pos] {
+		case a:
+			return true
+		case b:
+			return false
+		}
+	}
+	return false
+}
+
+// waitingCall returns the function call that is blocking the task, if any.
+func (t *task) waitingCall() *Call {
+	if !t.waiting || len(t.frames) == 0 {
+		return nil
+	}
+	if f, ok := t.frames[len(t.frames)-1].(*callFrame); ok && f.call.waiting {
+		return f.call
+	}
+	return nil
+}
+
+// newFrame builds the frame that executes a node.
+func (s *Script) newFrame(node *Node) frame {
+	switch node.Token.Value {
+	case gotoFunction:
+		return &gotoFrame{node: node}
+	case invertFunction, repeatUntilFailFunction, selectorFunction, sequenceFunction:
+		return &compositeFrame{node: node}
+	case parallelFunction:
+		return &parallelFrame{node: node}
+	case retryFunction:
+		return &retryFrame{node: node}
+	case spawnFunction:
+		return &spawnFrame{node: node}
+	case cancelFunction, joinFunction:
+		return &handleFrame{node: node}
+	case lockFunction:
+		return &lockFrame{node: node}
+	case emitFunction, receiveFunction:
+		return &messageFrame{node: node, receive: node.Token.Value == receiveFunction}
+	case handlerFunction, stateFunction:
+		return &failFrame{err: newRuntimeError(node, "'%s' blocks must be at the top level of the script", node.Token.Value)}
+	case onEnterFunction, onExitFunction:
+		return &failFrame{err: newRuntimeError(node, "'%s' blocks must be directly inside a state", node.Token.Value)}
+	case catchFunction, finallyFunction:
+		return &failFrame{err: newRuntimeError(node, "'%s' blocks must follow a try block", node.Token.Value)}
+	case onTimeoutFunction:
+		return &failFrame{err: newRuntimeError(node, "'%s' blocks must follow a %s block", node.Token.Value, timeoutFunction)}
+	}
+	return &callFrame{call: newCall(s, node)}
+}
+
+// failFrame fails as soon as it is executed.
+type failFrame struct {
+	err *RuntimeError
+}
+
+func (f *failFrame) current() *Node {
+	return nil
+}
+
+func (f *failFrame) step(t *task) {
+	t.pop(f.err)
+}
+
+// blockFrame executes a list of nodes in order, stopping at the first failure.
+type blockFrame struct {
+	nodes    []*Node
+	pos      int
+	topLevel bool
+}
+
+func (f *blockFrame) current() *Node {
+	if f.pos == 0 || f.pos > len(f.nodes) {
+		return nil
+	}
+	return f.nodes[f.pos-1]
+}
+
+func (f *blockFrame) step(t *task) {
+	if f.pos > 0 && t.result != nil {
+		t.pop(t.result)
+		return
+	}
+	if f.topLevel && t.script.startQueuedHandlers() {
+		// Let the handlers run before continuing
+		return
+	}
+	if f.pos >= len(f.nodes) {
+		t.pop(nil)
+		return
+	}
+
+	next, pos := t.script.blockFrame(f.nodes, f.pos)
+	f.pos = pos
+	t.push(next)
+}
+
+// blockFrame builds the frame for the node at pos in a block, and returns the position of the next node. A try block
+// also takes any catch and finally blocks that follow it, and a withTimeout block takes the onTimeout block that
+// follows it.
+func (s *Script) blockFrame(nodes []*Node, pos int) (frame, int) {
+	node := nodes[pos]
+	if node.Type == NodeFunction {
+		switch node.Token.Value {
+		case timeoutFunction:
+			return s.newTimeoutFrame(nodes, pos)
+		case tryFunction:
+			return s.newTryFrame(nodes, pos)
+		}
+	}
+	return s.newFrame(node), pos + 1
+}
+
+// callFrame executes a function, followed by its children (if any). If the function uses any resources they are
+// locked before it starts, and unlocked as soon as it finishes (before its children).
+type callFrame struct {
+	call     *Call
+	calling  bool
+	children bool
+	lock     *resourceLock
+	started  bool
+}
+
+func (f *callFrame) current() *Node {
+	return f.call.Node
+}
+
+func (f *callFrame) step(t *task) {
+	if f.children {
+		f.finish(t, t.result)
+		return
+	}
+
+	var err error
+	if !f.started {
+		f.started = true
+		t.script.tick(f.call.Node)
+		t.script.trace(TraceCallStarted, f.call.Node, nil, "Calling '%s'", f.call.Node.Token.Value)
+		definition, ok := t.script.Functions.Get(f.call.Node.Token.Value)
+		if !ok || definition.Function == nil {
+			err := newRuntimeError(f.call.Node, "Unknown function '%s'", f.call.Node.Token.Value)
+			err.Code = ErrorCodeUnknownFunction
+			f.finish(t, err)
+			return
+		}
+		f.call.function = definition.Function
+		if len(definition.Resources) > 0 {
+			f.lock = newResourceLock(f.call.Node, definition.Resources, t.script.locks().Timeout)
+		}
+	}
+	if !f.calling {
+		if f.lock != nil {
+			held, err := f.lock.wait(t)
+			if err != nil {
+				f.finish(t, err)
+				return
+			}
+			if !held {
+				return
+			}
+		}
+		f.calling = true
+		err = f.call.function.Start(f.call)
+	} else {
+		f.call.resumed = false
+		err = f.call.function.Resume(f.call)
+	}
+
+	switch {
+	case err != nil:
+		f.finish(t, wrapRuntimeError(f.call.Node, err))
+	case f.call.failed:
+		f.finish(t, newFailure(f.call.Node, "'%s' failed", f.call.Node.Token.Value))
+	case f.call.waiting:
+		t.waiting = true
+	case len(f.call.Node.Children) == 0:
+		f.finish(t, nil)
+	default:
+		f.unlock(t)
+		f.children = true
+		t.push(&blockFrame{nodes: f.call.Node.Children})
+	}
+}
+
+// cancel lets the function know when a call that is waiting is abandoned, and unlocks its resources.
+func (f *callFrame) cancel(t *task) bool {
+	if fn, ok := f.call.function.(CancellableFunction); ok && f.call.waiting {
+		f.call.waiting = false
+		fn.Cancel(f.call)
+	}
+	f.unlock(t)
+	return false
+}
+
+func (f *callFrame) finish(t *task, err error) {
+	f.unlock(t)
+	t.script.setStatus(f.call.Node, err)
+	if err != nil {
+		t.script.trace(TraceCallFinished, f.call.Node, map[string]string{"error": err.Error()}, "'%s' failed", f.call.Node.Token.Value)
+	} else {
+		t.script.trace(TraceCallFinished, f.call.Node, nil, "'%s' finished", f.call.Node.Token.Value)
+	}
+	t.pop(err)
+}
+
+func (f *callFrame) unlock(t *task) {
+	if f.lock != nil {
+		f.lock.release(t)
+		f.lock = nil
+	}
+}
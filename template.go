@@ -0,0 +1,77 @@
+package robolang
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Render converts the node into text, substituting the current value of any interpolated variables.
+func (n *Node) Render(variables *VariableTable) (string, error) {
+	if n.Type != NodeTemplate {
+		return n.Token.Value, nil
+	}
+
+	var buf strings.Builder
+	for _, child := range n.Children {
+		if child.Type != NodeVariable {
+			buf.WriteString(child.Token.Value)
+			continue
+		}
+
+		value, ok := variables.Value(child.Token.Value)
+		if !ok {
+			return "", newParseError(child.Token, "Unknown variable '%s'", child.Token.Value)
+		}
+		buf.WriteString(FormatValue(value))
+	}
+	return buf.String(), nil
+}
+
+// FormatValue converts a value into the standard display format for its type.
+func FormatValue(value string) string {
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return FormatNumber(number)
+	}
+	if quantity, err := Units.Parse(value); err == nil && quantity.Family == UnitTime {
+		return FormatDuration(time.Duration(quantity.Value * float64(time.Second)))
+	}
+	return value
+}
+
+// FormatNumber converts a number into text, dropping any trailing zeros.
+func FormatNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1e6)/1e6, 'f', -1, 64)
+}
+
+// FormatDuration converts a duration into the same form as a duration literal (e.g. 1d2h3m4s). Duration literals
+// cannot be more precise than a millisecond, so the duration is rounded to the nearest one.
+func FormatDuration(d time.Duration) string {
+	if d = d.Round(time.Millisecond); d == 0 {
+		return "0s"
+	}
+
+	var buf strings.Builder
+	if d < 0 {
+		buf.WriteRune('-')
+		d = -d
+	}
+	for _, part := range []struct {
+		unit   time.Duration
+		suffix string
+	}{
+		{24 * time.Hour, "d"},
+		{time.Hour, "h"},
+		{time.Minute, "m"},
+		{time.Second, "s"},
+		{time.Millisecond, "ms"},
+	} {
+		if d >= part.unit {
+			fmt.Fprintf(&buf, "%d%s", d/part.unit, part.suffix)
+			d %= part.unit
+		}
+	}
+	return buf.String()
+}
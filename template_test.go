@@ -0,0 +1,65 @@
+package robolang
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemplateRender(t *testing.T) {
+	variables := NewVariableTable(
+		NewVariable("name").Set("Robo"),
+		NewVariable("count").Set("3.50"),
+		NewVariable("wait").Set("90s"))
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"say(text='hello')", "hello"},
+		{"say(text='Hello {&name}, you have {&count} stars')", "Hello Robo, you have 3.5 stars"},
+		{"say(text='Back in {&wait}')", "Back in 1m30s"},
+		{"say(text='{{literal}}')", "{literal}"},
+	}
+	for _, test := range tests {
+		result := NewParser(test.input).Parse()
+		if len(result.Errors) > 0 {
+			t.Errorf("Unexpected errors while parsing `%s`: [%v]", test.input, result.Errors)
+			continue
+		}
+		actual, err := result.Nodes[0].Args[0].Children[0].Render(variables)
+		if err != nil {
+			t.Errorf("Unable to render `%s`: %v", test.input, err)
+		} else if actual != test.expected {
+			t.Errorf("Unexpected output for `%s`: expected [%s], got [%s]", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestTemplateRenderUnknownVariable(t *testing.T) {
+	result := NewParser("say(text='Hello {&name}')").Parse()
+	_, err := result.Nodes[0].Args[0].Children[0].Render(NewVariableTable())
+	if err == nil {
+		t.Errorf("Expected an error, not nil")
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		input    time.Duration
+		expected string
+	}{
+		{0, "0s"},
+		{250 * time.Millisecond, "250ms"},
+		{90 * time.Second, "1m30s"},
+		{26*time.Hour + 3*time.Second, "1d2h3s"},
+		{400 * time.Microsecond, "0s"},
+		{-400 * time.Microsecond, "0s"},
+		{1500 * time.Microsecond, "2ms"},
+		{-time.Second - 200*time.Microsecond, "-1s"},
+	}
+	for _, test := range tests {
+		actual := FormatDuration(test.input)
+		if actual != test.expected {
+			t.Errorf("Unexpected output for %v: expected [%s], got [%s]", test.input, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package robolang
+
+import "time"
+
+const (
+	onTimeoutFunction = "onTimeout"
+	timeoutFunction   = "withTimeout"
+)
+
+// timeoutFrame executes a `withTimeout(duration=10s):` block, together with the `onTimeout():` block that follows it
+// (if any). For example:
+//
+//	withTimeout(duration=30s):
+//	  waitForInput()
+//	onTimeout():
+//	  say(text='Are you still there?')
+//
+// When the time limit expires the block is abandoned (running any finally blocks and cancelling any functions that
+// are waiting), and the onTimeout block runs instead. Without an onTimeout block the timeout is an error.
+type timeoutFrame struct {
+	duration time.Duration
+	expired  bool
+	fallback *Node
+	node     *Node
+	started  bool
+	timer    *timer
+}
+
+// newTimeoutFrame builds the frame for the withTimeout block at pos, and returns the position after its onTimeout
+// block.
+func (s *Script) newTimeoutFrame(nodes []*Node, pos int) (frame, int) {
+	f := &timeoutFrame{node: nodes[pos]}
+	pos++
+	if pos < len(nodes) && nodes[pos].Type == NodeFunction && nodes[pos].Token.Value == onTimeoutFunction {
+		f.fallback = nodes[pos]
+		pos++
+	}
+	return f, pos
+}
+
+func (f *timeoutFrame) current() *Node {
+	return f.node
+}
+
+func (f *timeoutFrame) step(t *task) {
+	if !f.started {
+		f.started = true
+		duration, err := newCall(t.script, f.node).Duration("duration")
+		if err == nil && duration <= 0 {
+			err = newRuntimeError(f.node, "The duration of '%s' must be more than zero", timeoutFunction)
+		}
+		if err != nil {
+			t.pop(wrapRuntimeError(f.node, err))
+			return
+		}
+		f.duration = duration
+		f.timer = t.script.startTimer(duration, func() {
+			f.timer, f.expired = nil, true
+			// If an inner block is already being abandoned (e.g. a nested timeout expired at the same time), this
+			// block takes over as it is further down the stack
+			if t.unwind == nil || t.isAbove(t.unwind.target, f) {
+				t.unwindTo(f)
+			}
+		})
+		t.push(&blockFrame{nodes: f.node.Children})
+		return
+	}
+
+	if f.expired {
+		f.expired = false
+		if f.fallback == nil {
+			err := newRuntimeError(f.node, "Timed out after %s", FormatDuration(f.duration))
+			err.Code = ErrorCodeTimeout
+			t.pop(err)
+			return
+		}
+		t.push(&blockFrame{nodes: f.fallback.Children})
+		return
+	}
+
+	f.cancel(t)
+	t.pop(t.result)
+}
+
+// cancel stops the timer when the block is discarded (or finishes).
+func (f *timeoutFrame) cancel(t *task) bool {
+	if f.timer != nil {
+		t.script.stopTimer(f.timer)
+		f.timer = nil
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package robolang
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	var log []string
+	clock := NewManualClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	script := newTestScript(t, "withTimeout(duration=10s):\n  waitForInput():\n    say(text='input')\nonTimeout():\n  say(text='timeout')\nsay(text='done')", &log)
+	script.Clock = clock
+	script.Functions.Functions["waitForInput"].Function = &cancellableWait{waitForInput{log: &log}}
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if deadline, ok := script.NextDeadline(); !ok || !deadline.Equal(clock.Now().Add(10*time.Second)) {
+		t.Errorf("Unexpected deadline: %v", deadline)
+	}
+
+	clock.Advance(9 * time.Second)
+	script.Poll()
+	checkLog(t, log, "wait")
+
+	clock.Advance(time.Second)
+	if err := script.Poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,cancelled,timeout,done")
+	if script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), script.State.String())
+	}
+	if _, ok := script.NextDeadline(); ok {
+		t.Errorf("Unexpected timer still running")
+	}
+}
+
+func TestTimeoutNotReached(t *testing.T) {
+	var log []string
+	clock := NewManualClock(time.Now())
+	script := newTestScript(t, "withTimeout(duration=1m):\n  waitForInput()\nonTimeout():\n  say(text='timeout')\nwaitForInput()", &log)
+	script.Clock = clock
+	script.Start()
+	script.Resume("a")
+	clock.Advance(time.Hour)
+	script.Poll()
+	checkLog(t, log, "wait,input:a,wait")
+	if _, ok := script.NextDeadline(); ok {
+		t.Errorf("Unexpected timer still running")
+	}
+}
+
+func TestTimeoutErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"withTimeout(duration=0s):\n  waitForInput()", "The duration of 'withTimeout' must be more than zero at line 0, pos 0"},
+		{"withTimeout(duration=5cm):\n  waitForInput()", "Argument 'duration' must be a duration, found '5cm' at line 0, pos 0"},
+		{"withTimeout():\n  waitForInput()", "Missing argument 'duration' at line 0, pos 0"},
+		{"onTimeout():\n  waitForInput()", "'onTimeout' blocks must follow a withTimeout block at line 0, pos 0"},
+	}
+	for _, test := range tests {
+		var log []string
+		err := newTestScript(t, test.input, &log).Start()
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Unexpected error for `%s`: expected [%s], got [%v]", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestTimeoutWithoutFallback(t *testing.T) {
+	var log []string
+	clock := NewManualClock(time.Now())
+	script := newTestScript(t, "try():\n  withTimeout(duration=2):\n    try():\n      waitForInput()\n    finally():\n      say(text='finally')\ncatch(error=&err, code='timeout'):\n  say(text='{&err.message}')", &log)
+	script.Clock = clock
+	script.Start()
+	clock.Advance(2 * time.Second)
+	if err := script.Poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,finally,Timed out after 2s")
+}
+
+func TestNestedTimeouts(t *testing.T) {
+	var log []string
+	clock := NewManualClock(time.Now())
+	script := newTestScript(t, "withTimeout(duration=5s):\n  withTimeout(duration=10s):\n    waitForInput()\n  onTimeout():\n    say(text='inner')\nonTimeout():\n  say(text='outer')", &log)
+	script.Clock = clock
+	script.Start()
+	clock.Advance(time.Minute)
+	script.Poll()
+	checkLog(t, log, "wait,outer")
+	if _, ok := script.NextDeadline(); ok {
+		t.Errorf("Unexpected timer still running")
+	}
+}
+
+func TestNestedTimeoutsExpireTogether(t *testing.T) {
+	var log []string
+	clock := NewManualClock(time.Now())
+	script := newTestScript(t, "withTimeout(duration=10s):\n  withTimeout(duration=5s):\n    waitForInput()\n  onTimeout():\n    say(text='inner')\nonTimeout():\n  say(text='outer')", &log)
+	script.Clock = clock
+	script.Start()
+
+	// The inner timer fires first, but the outer block has expired too
+	clock.Advance(time.Minute)
+	if err := script.Poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,outer")
+	if script.State != ScriptStateFinished {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateFinished.String(), script.State.String())
+	}
+	if _, ok := script.NextDeadline(); ok {
+		t.Errorf("Unexpected timer still running")
+	}
+}
+
+type cancellableWait struct {
+	waitForInput
+}
+
+func (fn *cancellableWait) Cancel(call *Call) {
+	*fn.log = append(*fn.log, "cancelled")
+}
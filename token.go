@@ -1,12 +1,20 @@
 package robolang
 
+import "strings"
+
 // Token contains a token from the scanner.
 type Token struct {
+	File     string    `json:"file,omitempty"`
 	LineNum  int       `json:"lineNum"`
 	LinePos  int       `json:"linePos"`
+	Source   string    `json:"-"`
 	Type     TokenType `json:"-"`
 	TypeName string    `json:"type"`
 	Value    string    `json:"value"`
+
+	valueLine   int
+	valuePos    int
+	valueIndent int
 }
 
 // String converts the token to a human-readable form.
@@ -14,6 +22,42 @@ func (t *Token) String() string {
 	return "`" + t.Value + "` [" + t.Type.String() + "]"
 }
 
+// Start returns the location of the first character of the token
+func (t *Token) Start() Position {
+	return Position{LineNum: t.LineNum, LinePos: t.LinePos}
+}
+
+// End returns the location just after the last character of the token
+func (t *Token) End() Position {
+	source := t.Source
+	if source == "" {
+		source = t.Value
+	}
+
+	end := t.Start()
+	for _, ch := range source {
+		if ch == '\n' {
+			end.LineNum++
+			end.LinePos = 0
+		} else {
+			end.LinePos++
+		}
+	}
+	return end
+}
+
+// ValuePosition returns the source location of a character in a text token's value.
+func (t *Token) ValuePosition(offset int) (lineNum, linePos int) {
+	if t.Type != TokenText {
+		return t.LineNum, t.LinePos + offset
+	}
+	newLines := strings.Count(t.Value[:offset], "\n")
+	if newLines == 0 {
+		return t.valueLine, t.valuePos + offset
+	}
+	return t.valueLine + newLines, t.valueIndent + offset - strings.LastIndexByte(t.Value[:offset], '\n') - 1
+}
+
 // TokenType defines what the token can be used for.
 type TokenType int
 
@@ -70,4 +114,10 @@ const (
 
 	// TokenComment is a comment (#...)
 	TokenComment
+
+	// TokenQuantity is a numeric constant with units (30cm)
+	TokenQuantity
+
+	// TokenDirective is an instruction to the parser (#!...)
+	TokenDirective
 )
@@ -4,9 +4,9 @@ package robolang
 
 import "strconv"
 
-const _TokenType_name = "TokenIllegalTokenEOFTokenNewLineTokenWhitespaceTokenOpenBracketTokenCloseBracketTokenEqualsTokenCommaTokenColonTokenIdentifierTokenVariableTokenResourceTokenTextTokenNumberTokenDurationTokenOperatorTokenComment"
+const _TokenType_name = "TokenIllegalTokenEOFTokenNewLineTokenWhitespaceTokenOpenBracketTokenCloseBracketTokenEqualsTokenCommaTokenColonTokenIdentifierTokenVariableTokenResourceTokenTextTokenNumberTokenDurationTokenOperatorTokenCommentTokenQuantityTokenDirective"
 
-var _TokenType_index = [...]uint8{0, 12, 20, 32, 47, 63, 80, 91, 101, 111, 126, 139, 152, 161, 172, 185, 198, 210}
+var _TokenType_index = [...]uint8{0, 12, 20, 32, 47, 63, 80, 91, 101, 111, 126, 139, 152, 161, 172, 185, 198, 210, 223, 237}
 
 func (i TokenType) String() string {
 	if i < 0 || i >= TokenType(len(_TokenType_index)-1) {
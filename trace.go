@@ -0,0 +1,137 @@
+package robolang
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TraceKind defines the type of a trace event
+type TraceKind int
+
+//go:generate stringer -type=TraceKind
+
+const (
+	// TraceCallStarted means a function has been called
+	TraceCallStarted TraceKind = iota
+
+	// TraceCallFinished means a function has finished (successfully or not)
+	TraceCallFinished
+
+	// TraceStateChanged means the state machine has changed state
+	TraceStateChanged
+
+	// TraceRetry means a retry block is about to try again after a failure
+	TraceRetry
+
+	// TracePreempted means a scheduler has paused the script to run a higher priority script
+	TracePreempted
+
+	// TraceLockWaiting means a call or lock block is waiting for resources that are in use
+	TraceLockWaiting
+
+	// TraceLockAcquired means a call or lock block has acquired the resources it was waiting for
+	TraceLockAcquired
+
+	// TraceMessageSent means a message has been sent on a channel
+	TraceMessageSent
+
+	// TraceMessageReceived means a message has been received from a channel
+	TraceMessageReceived
+)
+
+// TraceEvent is something that happened while a script was running
+type TraceEvent struct {
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Kind       TraceKind         `json:"-"`
+	KindText   string            `json:"kind"`
+	Message    string            `json:"message"`
+	Node       *Node             `json:"-"`
+	Time       time.Time         `json:"time"`
+}
+
+// Tracer receives a trace event for everything that happens while a script is running
+type Tracer interface {
+	Trace(event *TraceEvent)
+}
+
+// TracerFunc adapts an ordinary Go function to a Tracer
+type TracerFunc func(event *TraceEvent)
+
+// Trace calls the function
+func (fn TracerFunc) Trace(event *TraceEvent) {
+	fn(event)
+}
+
+// AuditLog is a record of the notable things that happened while a script was running (e.g. retries), so operators
+// can spot problems such as flaky hardware.
+type AuditLog struct {
+	entries []*AuditEntry
+	lock    sync.Mutex
+}
+
+// AuditEntry is a single entry in an audit log
+type AuditEntry struct {
+	File         string    `json:"file,omitempty"`
+	LineNumber   int       `json:"line"`
+	LinePosition int       `json:"pos"`
+	Message      string    `json:"message"`
+	Time         time.Time `json:"time"`
+}
+
+// NewAuditLog starts a new, empty, audit log
+func NewAuditLog() *AuditLog {
+	return &AuditLog{}
+}
+
+// Add adds an entry to the log
+func (log *AuditLog) Add(entry *AuditEntry) {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	log.entries = append(log.entries, entry)
+}
+
+// Entries returns all the entries in the log, oldest first
+func (log *AuditLog) Entries() []*AuditEntry {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	return append([]*AuditEntry{}, log.entries...)
+}
+
+// String converts the entry to a human-readable form.
+func (entry *AuditEntry) String() string {
+	if entry.File != "" {
+		return fmt.Sprintf("%s in %s at line %d, pos %d", entry.Message, entry.File, entry.LineNumber, entry.LinePosition)
+	}
+	return fmt.Sprintf("%s at line %d, pos %d", entry.Message, entry.LineNumber, entry.LinePosition)
+}
+
+// audit adds an entry to the script's audit log (if it has one).
+func (s *Script) audit(node *Node, format string, a ...interface{}) {
+	if s.AuditLog == nil {
+		return
+	}
+	entry := &AuditEntry{
+		Message: fmt.Sprintf(format, a...),
+		Time:    s.now(),
+	}
+	if node != nil && node.Token != nil {
+		entry.File, entry.LineNumber, entry.LinePosition = node.Token.File, node.Token.LineNum, node.Token.LinePos
+	}
+	s.AuditLog.Add(entry)
+}
+
+// trace sends an event to the script's tracer (if it has one).
+func (s *Script) trace(kind TraceKind, node *Node, attributes map[string]string, format string, a ...interface{}) {
+	if s.Tracer == nil {
+		return
+	}
+	s.Tracer.Trace(&TraceEvent{
+		Attributes: attributes,
+		Kind:       kind,
+		KindText:   kind.String(),
+		Message:    fmt.Sprintf(format, a...),
+		Node:       node,
+		Time:       s.now(),
+	})
+}
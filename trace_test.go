@@ -0,0 +1,25 @@
+package robolang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	var log, events []string
+	script := newTestScript(t, "say(text='a')\nstate(name='idle'):\n  unknown()", &log)
+	script.AuditLog = NewAuditLog()
+	script.Tracer = TracerFunc(func(event *TraceEvent) {
+		events = append(events, event.KindText+":"+event.Message)
+	})
+	script.Start()
+
+	expected := "TraceCallStarted:Calling 'say',TraceCallFinished:'say' finished,TraceStateChanged:Entering state 'idle'," +
+		"TraceCallStarted:Calling 'unknown',TraceCallFinished:'unknown' failed"
+	if actual := strings.Join(events, ","); actual != expected {
+		t.Errorf("Unexpected trace: expected\n%s\ngot\n%s", expected, actual)
+	}
+	if entries := script.AuditLog.Entries(); len(entries) != 1 || entries[0].String() != "Entered state 'idle' at line 1, pos 0" {
+		t.Errorf("Unexpected audit log: %v", entries)
+	}
+}
@@ -0,0 +1,148 @@
+package robolang
+
+const (
+	catchFunction   = "catch"
+	finallyFunction = "finally"
+	tryFunction     = "try"
+)
+
+type tryPhase int
+
+const (
+	tryStarting tryPhase = iota
+	tryRunning
+	tryCatching
+	tryFinally
+	tryDone
+)
+
+// tryFrame executes a `try():` block together with the `catch():` and `finally():` blocks that follow it. For
+// example:
+//
+//	try():
+//	  move(distance=1m)
+//	catch(error=&err, code='blocked'):
+//	  say(text='Something is in the way')
+//	catch(error=&err):
+//	  say(text='Failed with {&err.code}: {&err.message}')
+//	finally():
+//	  stop()
+//
+// The first catch block that matches the error's code (or has no code) handles the error. The finally block always
+// runs, including when the try block is abandoned (e.g. by a state change or the script being cancelled).
+type tryFrame struct {
+	catches   []*Node
+	err       error
+	finally   *Node
+	node      *Node
+	phase     tryPhase
+	unwinding *unwinding
+}
+
+// newTryFrame builds the frame for the try block at pos, and returns the position after its catch and finally blocks.
+func (s *Script) newTryFrame(nodes []*Node, pos int) (frame, int) {
+	f := &tryFrame{node: nodes[pos]}
+	for pos++; pos < len(nodes) && nodes[pos].Type == NodeFunction; pos++ {
+		node := nodes[pos]
+		switch {
+		case node.Token.Value == catchFunction && f.finally == nil:
+			for _, arg := range node.Args {
+				if name := arg.Token.Value; name != "error" && name != "code" {
+					return &failFrame{err: newRuntimeError(arg, "Unknown catch argument '%s'", name)}, pos + 1
+				}
+			}
+			if arg := newCall(s, node).Arg("error"); arg != nil && arg.Type != NodeVariable {
+				return &failFrame{err: newRuntimeError(arg, "Catch argument 'error' must be a variable")}, pos + 1
+			}
+			f.catches = append(f.catches, node)
+			continue
+		case node.Token.Value == finallyFunction && f.finally == nil:
+			f.finally = node
+			continue
+		}
+		break
+	}
+	if len(f.catches) == 0 && f.finally == nil {
+		return &failFrame{err: newRuntimeError(f.node, "'try' blocks must be followed by a catch or finally block")}, pos
+	}
+	return f, pos
+}
+
+func (f *tryFrame) current() *Node {
+	return f.node
+}
+
+func (f *tryFrame) step(t *task) {
+	switch f.phase {
+	case tryStarting:
+		f.phase = tryRunning
+		t.push(&blockFrame{nodes: f.node.Children})
+
+	case tryRunning:
+		if t.result != nil {
+			if catch := f.match(t.result); catch != nil {
+				f.catch(t, catch)
+				return
+			}
+		}
+		f.runFinally(t, t.result)
+
+	case tryCatching:
+		f.runFinally(t, t.result)
+
+	case tryFinally:
+		if t.result != nil {
+			f.err = t.result
+		}
+		f.phase = tryDone
+		if f.unwinding == nil {
+			t.pop(f.err)
+			return
+		}
+		if t.result != nil && f.unwinding.target != nil {
+			// An error in the finally block stops the try block being abandoned
+			t.pop(t.result)
+			return
+		}
+		t.unwind = f.unwinding
+	}
+}
+
+// cancel runs the finally block before the try block is discarded.
+func (f *tryFrame) cancel(t *task) bool {
+	if f.phase == tryFinally || f.phase == tryDone || f.finally == nil {
+		return false
+	}
+	f.unwinding, t.unwind = t.unwind, nil
+	f.runFinally(t, nil)
+	return true
+}
+
+func (f *tryFrame) catch(t *task, catch *Node) {
+	f.phase = tryCatching
+	if arg := newCall(t.script, catch).Arg("error"); arg != nil {
+		err := asRuntimeError(f.node, t.result)
+		t.script.setVariable(arg.Token.Value, err.Message).SetFields(err.fields())
+	}
+	t.push(&blockFrame{nodes: catch.Children})
+}
+
+// match finds the first catch block that handles an error.
+func (f *tryFrame) match(err error) *Node {
+	code := asRuntimeError(f.node, err).Code
+	for _, catch := range f.catches {
+		if expected, ok := constantArg(catch, "code"); !ok || expected.Token.Value == code {
+			return catch
+		}
+	}
+	return nil
+}
+
+func (f *tryFrame) runFinally(t *task, err error) {
+	f.err, f.phase = err, tryFinally
+	var nodes []*Node
+	if f.finally != nil {
+		nodes = f.finally.Children
+	}
+	t.push(&blockFrame{nodes: nodes})
+}
@@ -0,0 +1,100 @@
+package robolang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTry(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"try():\n  say(text='a')\ncatch():\n  say(text='caught')\nsay(text='b')", "a,b", ""},
+		{"try():\n  fail(message='oops')\n  say(text='skipped')\ncatch(error=&err):\n  say(text='{&err} {&err.code} {&err.line}:{&err.pos}')\nsay(text='b')", "oops function 1:2,b", ""},
+		{"try():\n  fail(message='oops')\nfinally():\n  say(text='finally')\nsay(text='b')", "finally", "oops at line 1, pos 2"},
+		{"try():\n  fail(message='oops')\ncatch():\n  fail(message='again')\nfinally():\n  say(text='finally')", "finally", "again at line 3, pos 2"},
+		{"try():\n  say(text='a')\nfinally():\n  fail(message='finally')", "a", "finally at line 3, pos 2"},
+		{"try():\n  unknown()\ncatch(code='function'):\n  say(text='function')\ncatch(error=&err, code='unknownFunction'):\n  say(text='{&err.message}')", "Unknown function 'unknown'", ""},
+		{"try():\n  unknown()\ncatch(code='function'):\n  say(text='function')", "", "Unknown function 'unknown' at line 1, pos 2"},
+		{"try():\n  try():\n    fail(message='inner')\n  finally():\n    say(text='inner finally')\ncatch(error=&err):\n  say(text='outer {&err}')", "inner finally,outer inner", ""},
+		{"sequence():\n  try():\n    isTrue(value='no')\n  catch(error=&err):\n    say(text='{&err.code}')\n  say(text='a')", "failed,a", ""},
+		{"catch():\n  say(text='a')", "", "'catch' blocks must follow a try block at line 0, pos 0"},
+		{"try():\n  say(text='a')\nsay(text='b')", "", "'try' blocks must be followed by a catch or finally block at line 0, pos 0"},
+		{"try():\n  say(text='a')\ncatch(error='err'):\n  say(text='b')", "", "Catch argument 'error' must be a variable at line 2, pos 12"},
+		{"try():\n  say(text='a')\nfinally():\n  say(text='b')\ncatch():\n  say(text='c')", "a,b", "'catch' blocks must follow a try block at line 4, pos 0"},
+	}
+	for _, test := range tests {
+		var log []string
+		script := newBehaviourScript(t, test.input, &log)
+		err := script.Start()
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("Unexpected error for `%s`: expected [%s], got [%v]", test.input, test.err, err)
+		}
+		if actual := strings.Join(log, ","); actual != test.expected {
+			t.Errorf("Unexpected log for `%s`: expected [%s], got [%s]", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestTryFunctionErrorCode(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "try():\n  blocked()\ncatch(error=&err, code='blocked'):\n  say(text='{&err.message}')", &log)
+	script.Functions.Functions["blocked"] = NewFunction("blocked").SetFunction(FunctionFunc(func(call *Call) error {
+		return NewError("blocked", "Path is blocked")
+	}))
+	if err := script.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "Path is blocked")
+	if snapshot := script.Snapshot(); snapshot.Variables["err.line"] != "1" || snapshot.Variables["err.code"] != "blocked" {
+		t.Errorf("Unexpected snapshot variables: %v", snapshot.Variables)
+	}
+}
+
+func TestFinallyOnCancel(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "try():\n  waitForInput()\n  say(text='skipped')\nfinally():\n  say(text='finally')\nsay(text='skipped')", &log)
+	script.Start()
+	if err := script.Cancel(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLog(t, log, "wait,finally")
+	if script.State != ScriptStateCancelled {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateCancelled.String(), script.State.String())
+	}
+	if err := script.Cancel(); err != ErrScriptNotRunning {
+		t.Errorf("Unexpected error: expected %v, got %v", ErrScriptNotRunning, err)
+	}
+}
+
+func TestFinallyWaitsOnCancel(t *testing.T) {
+	var log []string
+	script := newBehaviourScript(t, "parallel():\n  sequence():\n    try():\n      waitForInput()\n    finally():\n      waitForInput()\n      say(text='finally')\n  waitForInput()", &log)
+	script.Start()
+	script.Cancel()
+	checkLog(t, log, "wait,wait,wait")
+	if script.State != ScriptStateWaiting {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateWaiting.String(), script.State.String())
+	}
+	if err := script.Raise("event"); err != ErrScriptNotRunning {
+		t.Errorf("Unexpected error: expected %v, got %v", ErrScriptNotRunning, err)
+	}
+
+	script.Resume("x")
+	checkLog(t, log, "wait,wait,wait,input:x,finally")
+	if script.State != ScriptStateCancelled {
+		t.Errorf("Unexpected script state: expected %s, actual %s", ScriptStateCancelled.String(), script.State.String())
+	}
+}
+
+func TestFinallyOnStateChange(t *testing.T) {
+	var log []string
+	input := "state(name='idle'):\n  try():\n    waitForInput():\n      goto(state='busy')\n  finally():\n    say(text='finally')\n" +
+		"state(name='busy'):\n  say(text='busy')"
+	script := newTestScript(t, input, &log)
+	script.Start()
+	script.Resume("")
+	checkLog(t, log, "wait,input:,finally,busy")
+}
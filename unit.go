@@ -0,0 +1,191 @@
+package robolang
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// UnitFamily defines a group of units that measure the same kind of quantity.
+type UnitFamily int
+
+//go:generate stringer -type=UnitFamily
+
+const (
+	// UnitNone means the value does not have any units
+	UnitNone UnitFamily = iota
+
+	// UnitLength is a distance (canonical unit is metres, shown in centimetres)
+	UnitLength
+
+	// UnitAngle is a rotation (canonical unit is degrees)
+	UnitAngle
+
+	// UnitPercent is a proportion (canonical unit is percent)
+	UnitPercent
+
+	// UnitSpeed is a velocity (canonical unit is metres per second)
+	UnitSpeed
+
+	// UnitTime is a duration (canonical unit is seconds)
+	UnitTime
+)
+
+// Unit defines a single unit of measure.
+type Unit struct {
+	Name   string
+	Family UnitFamily
+	Factor float64
+}
+
+// UnitRegistry contains all the units that can be used in a quantity, keyed by their suffix. It can be used from
+// several goroutines, so units can be registered while files are being parsed.
+type UnitRegistry struct {
+	lock  sync.RWMutex
+	units map[string]*Unit
+}
+
+// Units is the default registry used by the scanner and parser.
+//
+// Note that `m` is minutes (as in `5m`), so metres need to be written using another length unit (e.g. `100cm`).
+var Units = NewUnitRegistry(
+	&Unit{Name: "mm", Family: UnitLength, Factor: 0.001},
+	&Unit{Name: "cm", Family: UnitLength, Factor: 0.01},
+	&Unit{Name: "km", Family: UnitLength, Factor: 1000},
+	&Unit{Name: "in", Family: UnitLength, Factor: 0.0254},
+	&Unit{Name: "ft", Family: UnitLength, Factor: 0.3048},
+	&Unit{Name: "deg", Family: UnitAngle, Factor: 1},
+	&Unit{Name: "rad", Family: UnitAngle, Factor: 57.29577951308232},
+	&Unit{Name: "rev", Family: UnitAngle, Factor: 360},
+	&Unit{Name: "%", Family: UnitPercent, Factor: 1},
+	&Unit{Name: "mps", Family: UnitSpeed, Factor: 1},
+	&Unit{Name: "cmps", Family: UnitSpeed, Factor: 0.01},
+	&Unit{Name: "kph", Family: UnitSpeed, Factor: 1 / 3.6},
+	&Unit{Name: "ms", Family: UnitTime, Factor: 0.001},
+	&Unit{Name: "s", Family: UnitTime, Factor: 1},
+	&Unit{Name: "m", Family: UnitTime, Factor: 60},
+	&Unit{Name: "h", Family: UnitTime, Factor: 3600},
+	&Unit{Name: "d", Family: UnitTime, Factor: 86400},
+)
+
+// displayUnits are the units used when converting a quantity back to text. Lengths are shown in centimetres, as `m`
+// would be read back as minutes.
+var displayUnits = map[UnitFamily]string{
+	UnitLength:  "cm",
+	UnitAngle:   "deg",
+	UnitPercent: "%",
+	UnitSpeed:   "mps",
+	UnitTime:    "s",
+}
+
+// NewUnitRegistry starts a new unit registry
+func NewUnitRegistry(units ...*Unit) *UnitRegistry {
+	registry := &UnitRegistry{units: map[string]*Unit{}}
+	for _, unit := range units {
+		registry.units[unit.Name] = unit
+	}
+	return registry
+}
+
+// Get attempts to retrieve a unit from the registry
+func (registry *UnitRegistry) Get(name string) (*Unit, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	unit, ok := registry.units[name]
+	return unit, ok
+}
+
+// Register adds a new unit to the registry
+func (registry *UnitRegistry) Register(unit *Unit) error {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if _, exists := registry.units[unit.Name]; exists {
+		return fmt.Errorf("Unit %s already exists", unit.Name)
+	}
+	registry.units[unit.Name] = unit
+	return nil
+}
+
+// Parse converts a literal (e.g. 30cm or 1d2h) into a quantity in canonical units.
+func (registry *UnitRegistry) Parse(literal string) (*Quantity, error) {
+	var quantity *Quantity
+	for rest := literal; rest != ""; {
+		numberEnd := strings.IndexFunc(rest, func(ch rune) bool {
+			return (ch < '0' || ch > '9') && ch != '.'
+		})
+		if numberEnd == 0 {
+			return nil, fmt.Errorf("Invalid quantity %s", literal)
+		}
+		if numberEnd < 0 {
+			numberEnd = len(rest)
+		}
+		value, err := strconv.ParseFloat(rest[:numberEnd], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid quantity %s", literal)
+		}
+
+		rest = rest[numberEnd:]
+		unitEnd := strings.IndexFunc(rest, func(ch rune) bool {
+			return ch >= '0' && ch <= '9'
+		})
+		if unitEnd < 0 {
+			unitEnd = len(rest)
+		}
+		name := rest[:unitEnd]
+		rest = rest[unitEnd:]
+
+		family, factor := UnitNone, 1.0
+		if name != "" {
+			unit, ok := registry.Get(name)
+			if !ok {
+				return nil, fmt.Errorf("Unknown unit %s in %s", name, literal)
+			}
+			family, factor = unit.Family, unit.Factor
+		}
+
+		if quantity == nil {
+			quantity = NewQuantity(0, family)
+		} else if quantity.Family != family {
+			return nil, fmt.Errorf("Cannot mix %s and %s in %s", quantity.Family.Name(), family.Name(), literal)
+		}
+		quantity.Value += value * factor
+	}
+
+	if quantity == nil {
+		return nil, fmt.Errorf("Invalid quantity %s", literal)
+	}
+	return quantity, nil
+}
+
+// Name returns the short name of the family (e.g. length).
+func (family UnitFamily) Name() string {
+	return strings.ToLower(strings.TrimPrefix(family.String(), "Unit"))
+}
+
+// Quantity is a value with units that has been converted to the canonical unit for its family.
+type Quantity struct {
+	Family     UnitFamily `json:"-"`
+	FamilyName string     `json:"family"`
+	Value      float64    `json:"value"`
+}
+
+// NewQuantity starts a new quantity
+func NewQuantity(value float64, family UnitFamily) *Quantity {
+	return &Quantity{
+		Family:     family,
+		FamilyName: family.String(),
+		Value:      value,
+	}
+}
+
+// String converts the quantity to a human-readable form, which can be parsed back into the same quantity.
+func (q *Quantity) String() string {
+	value, name := q.Value, displayUnits[q.Family]
+	if unit, ok := Units.Get(name); ok && unit.Family == q.Family {
+		// Round away any error from converting the units (e.g. 0.3 / 0.01)
+		value = math.Round(value/unit.Factor*1e9) / 1e9
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64) + name
+}
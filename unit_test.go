@@ -0,0 +1,124 @@
+package robolang
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestUnitParse(t *testing.T) {
+	tests := []struct {
+		input  string
+		family UnitFamily
+		value  float64
+	}{
+		{"5", UnitNone, 5},
+		{"30cm", UnitLength, 0.3},
+		{"2km", UnitLength, 2000},
+		{"180deg", UnitAngle, 180},
+		{"0.5rev", UnitAngle, 180},
+		{"40%", UnitPercent, 40},
+		{"1d2h3m4s", UnitTime, 93784},
+		{"500ms", UnitTime, 0.5},
+	}
+	for _, test := range tests {
+		actual, err := Units.Parse(test.input)
+		if err != nil {
+			t.Errorf("Unable to parse %s: %v", test.input, err)
+			continue
+		}
+		if actual.Family != test.family || actual.Value != test.value {
+			t.Errorf("Unexpected quantity for %s: expected %v %s, actual %v %s",
+				test.input,
+				test.value, test.family.String(),
+				actual.Value, actual.Family.String())
+		}
+	}
+}
+
+func TestQuantityString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5", "5"},
+		{"30cm", "30cm"},
+		{"2km", "200000cm"},
+		{"12.5mm", "1.25cm"},
+		{"0.5rev", "180deg"},
+		{"36kph", "10mps"},
+		{"1m30s", "90s"},
+	}
+	for _, test := range tests {
+		quantity, err := Units.Parse(test.input)
+		if err != nil {
+			t.Errorf("Unable to parse %s: %v", test.input, err)
+			continue
+		}
+		if actual := quantity.String(); actual != test.expected {
+			t.Errorf("Unexpected text for %s: expected %s, actual %s", test.input, test.expected, actual)
+		}
+		again, err := Units.Parse(quantity.String())
+		if err != nil || again.Family != quantity.Family || math.Abs(again.Value-quantity.Value) > 1e-9 {
+			t.Errorf("%s did not parse back to the same quantity: %v", quantity.String(), again)
+		}
+	}
+}
+
+func TestUnitParseErrors(t *testing.T) {
+	tests := []string{"", "cm", "5xyz", "5cm3deg"}
+	for _, test := range tests {
+		if _, err := Units.Parse(test); err == nil {
+			t.Errorf("Expected an error parsing %s, not nil", test)
+		}
+	}
+}
+
+func TestUnitRegister(t *testing.T) {
+	registry := NewUnitRegistry(&Unit{Name: "cm", Family: UnitLength, Factor: 0.01})
+	if err := registry.Register(&Unit{Name: "cm", Family: UnitLength, Factor: 0.01}); err == nil {
+		t.Errorf("Expected an error, not nil")
+	}
+	if err := registry.Register(&Unit{Name: "yd", Family: UnitLength, Factor: 0.9144}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, ok := registry.Get("yd"); !ok {
+		t.Errorf("Missing unit 'yd'")
+	}
+}
+
+func TestUnitRegisterWhileParsing(t *testing.T) {
+	registry := NewUnitRegistry(&Unit{Name: "cm", Family: UnitLength, Factor: 0.01})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for count := 0; count < 100; count++ {
+			registry.Register(&Unit{Name: "u" + strconv.Itoa(count), Family: UnitLength, Factor: 1})
+		}
+	}()
+	for count := 0; count < 100; count++ {
+		if _, err := registry.Parse("30cm"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	<-done
+}
+
+func TestCallQuantity(t *testing.T) {
+	var log []string
+	script := newTestScript(t, "move(distance=30cm)\nset(variable=&d,value='1ft')\nmove(distance=&d)\nmove(distance=5)\nmove(distance='far')", &log)
+	script.Functions.Functions["move"] = NewFunction("move").SetFunction(FunctionFunc(func(call *Call) error {
+		distance, err := call.Quantity("distance")
+		if err != nil {
+			return err
+		}
+		log = append(log, distance.Family.Name()+":"+strconv.FormatFloat(distance.Value, 'f', 4, 64))
+		return nil
+	}))
+	err := script.Start()
+	checkLog(t, log, "length:0.3000,length:0.3048,none:5.0000")
+	expected := "Argument 'distance' must be a quantity, found 'far' at line 4, pos 0"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: expected [%s], got [%v]", expected, err)
+	}
+}
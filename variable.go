@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
 )
 
 // VariableTable defines all the available variables for a block
@@ -27,6 +28,9 @@ func NewVariableTable(variables ...*VariableDefinition) *VariableTable {
 
 // Get attempts to retrieve a value from table
 func (table *VariableTable) Get(name string) (*VariableDefinition, bool) {
+	if table == nil {
+		return nil, false
+	}
 	value, exists := table.Variables[name]
 	if exists {
 		return value, true
@@ -37,6 +41,26 @@ func (table *VariableTable) Get(name string) (*VariableDefinition, bool) {
 	return nil, false
 }
 
+// Value returns the current value of a variable, or one of its fields (e.g. err.code)
+func (table *VariableTable) Value(path string) (string, bool) {
+	name, field := path, ""
+	if pos := strings.Index(path, "."); pos >= 0 {
+		name, field = path[:pos], path[pos+1:]
+	}
+	variable, ok := table.Get(name)
+	if !ok {
+		return "", false
+	}
+	if field != "" {
+		value, ok := variable.Fields[field]
+		return value, ok
+	}
+	if variable.Value == nil {
+		return "", false
+	}
+	return *variable.Value, true
+}
+
 // Add adds a new variable to the table
 func (table *VariableTable) Add(name string) (*VariableDefinition, error) {
 	_, exists := table.Variables[name]
@@ -97,8 +121,9 @@ func (vd VariableDefinitions) Swap(i, j int) {
 
 // VariableDefinition defines a variable that holds a value
 type VariableDefinition struct {
-	Name  string  `json:"name"`
-	Value *string `json:"value,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+	Name   string            `json:"name"`
+	Value  *string           `json:"value,omitempty"`
 }
 
 // NewVariable starts a new variable definition
@@ -106,8 +131,14 @@ func NewVariable(name string) *VariableDefinition {
 	return &VariableDefinition{Name: name}
 }
 
-// Set sets the value of the variable
+// Set sets the value of the variable, clearing any fields
 func (variable *VariableDefinition) Set(value string) *VariableDefinition {
-	variable.Value = &value
+	variable.Value, variable.Fields = &value, nil
+	return variable
+}
+
+// SetFields sets the fields of a structured value (e.g. an error)
+func (variable *VariableDefinition) SetFields(fields map[string]string) *VariableDefinition {
+	variable.Fields = fields
 	return variable
 }
@@ -0,0 +1,213 @@
+package robolang
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is a version of the language (e.g. 1.2)
+type Version struct {
+	Major int
+	Minor int
+}
+
+// CurrentVersion is the newest version of the language that the parser understands
+var CurrentVersion = Version{Major: 1, Minor: 2}
+
+// ParseVersion converts text (e.g. 1.2) into a version
+func ParseVersion(text string) (Version, error) {
+	parts := strings.Split(text, ".")
+	if len(parts) != 2 {
+		return Version{}, fmt.Errorf("Invalid language version '%s', expected major.minor", text)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major < 0 {
+		return Version{}, fmt.Errorf("Invalid language version '%s', expected major.minor", text)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil || minor < 0 {
+		return Version{}, fmt.Errorf("Invalid language version '%s', expected major.minor", text)
+	}
+	return Version{Major: major, Minor: minor}, nil
+}
+
+// IsZero checks whether the version has been set
+func (v Version) IsZero() bool {
+	return v.Major == 0 && v.Minor == 0
+}
+
+// Less checks whether this version is older than another version
+func (v Version) Less(other Version) bool {
+	return v.Major < other.Major || (v.Major == other.Major && v.Minor < other.Minor)
+}
+
+// String converts the version to a human-readable form.
+func (v Version) String() string {
+	return strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor)
+}
+
+// Language features that need a newer version than 1.0
+const (
+	FeatureBehaviourTrees = "behaviour trees"
+	FeatureConcurrency    = "concurrency"
+	FeatureErrorHandling  = "error handling"
+	FeatureEventHandlers  = "event handlers"
+	FeatureMessaging      = "messaging"
+	FeatureMultiLineArgs  = "multi-line arguments"
+	FeatureMultiLineText  = "multi-line text"
+	FeatureQuantities     = "quantity literals"
+	FeatureResourceLocks  = "resource locks"
+	FeatureRetries        = "retries"
+	FeatureScriptHeader   = "script header"
+	FeatureStateMachines  = "state machines"
+	FeatureTemplates      = "text interpolation"
+	FeatureTimeouts       = "timeouts"
+	FeatureTrailingComma  = "trailing commas"
+)
+
+// Features maps each language feature to the version it was introduced in
+var Features = map[string]Version{
+	FeatureBehaviourTrees: {1, 2},
+	FeatureConcurrency:    {1, 2},
+	FeatureErrorHandling:  {1, 2},
+	FeatureEventHandlers:  {1, 2},
+	FeatureMessaging:      {1, 2},
+	FeatureMultiLineArgs:  {1, 1},
+	FeatureMultiLineText:  {1, 1},
+	FeatureQuantities:     {1, 1},
+	FeatureResourceLocks:  {1, 2},
+	FeatureRetries:        {1, 2},
+	FeatureScriptHeader:   {1, 1},
+	FeatureStateMachines:  {1, 2},
+	FeatureTemplates:      {1, 1},
+	FeatureTimeouts:       {1, 2},
+	FeatureTrailingComma:  {1, 1},
+}
+
+// functionFeatures maps the built-in functions to the language feature they belong to
+var functionFeatures = map[string]string{
+	cancelFunction:          FeatureConcurrency,
+	catchFunction:           FeatureErrorHandling,
+	emitFunction:            FeatureMessaging,
+	finallyFunction:         FeatureErrorHandling,
+	gotoFunction:            FeatureStateMachines,
+	handlerFunction:         FeatureEventHandlers,
+	invertFunction:          FeatureBehaviourTrees,
+	joinFunction:            FeatureConcurrency,
+	lockFunction:            FeatureResourceLocks,
+	parallelFunction:        FeatureBehaviourTrees,
+	receiveFunction:         FeatureMessaging,
+	repeatUntilFailFunction: FeatureBehaviourTrees,
+	retryFunction:           FeatureRetries,
+	selectorFunction:        FeatureBehaviourTrees,
+	sequenceFunction:        FeatureBehaviourTrees,
+	spawnFunction:           FeatureConcurrency,
+	onTimeoutFunction:       FeatureTimeouts,
+	stateFunction:           FeatureStateMachines,
+	timeoutFunction:         FeatureTimeouts,
+	tryFunction:             FeatureErrorHandling,
+}
+
+const versionDirective = "robolang"
+
+// MinimumVersion returns the oldest language version that can run the script, based on the features it uses.
+func (result *ParseResult) MinimumVersion() Version {
+	minimum := Version{Major: 1}
+	for feature := range result.features {
+		if version := Features[feature]; minimum.Less(version) {
+			minimum = version
+		}
+	}
+	return minimum
+}
+
+// UsedFeatures returns the names of all the versioned features that the script uses
+func (result *ParseResult) UsedFeatures() []string {
+	var features []string
+	for feature := range result.features {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// checkFeatures makes sure the script does not use any features that are newer than the version it declares.
+func (result *ParseResult) checkFeatures() {
+	declared := result.LanguageVersion
+	if declared.IsZero() && result.Metadata != nil && result.Metadata.LanguageVersion != "" {
+		version, err := ParseVersion(result.Metadata.LanguageVersion)
+		if err != nil {
+			result.addError(newParseError(result.Metadata.Node.Token, "%v", err))
+			return
+		}
+		declared = version
+		result.LanguageVersion = version
+	}
+	if declared.IsZero() {
+		return
+	}
+
+	var used []string
+	for feature := range result.features {
+		used = append(used, feature)
+	}
+	sort.Slice(used, func(i, j int) bool {
+		return result.features[used[i]].Start().Before(result.features[used[j]].Start())
+	})
+	for _, feature := range used {
+		if version := Features[feature]; declared.Less(version) {
+			result.addError(newParseError(result.features[feature], "Using %s requires robolang %s, but the script declares %s", feature, version, declared))
+		}
+	}
+}
+
+func (result *ParseResult) useFeature(feature string, tok *Token) {
+	if result.features == nil {
+		result.features = map[string]*Token{}
+	}
+	if _, ok := result.features[feature]; !ok {
+		result.features[feature] = tok
+	}
+}
+
+// trackDirective handles any parser directives (#!), currently only the language version (#! robolang 1.2).
+func (p *Parser) trackDirective(token *Token) {
+	switch token.Type {
+	case TokenWhitespace, TokenComment, TokenNewLine:
+		return
+	case TokenDirective:
+	default:
+		p.started = true
+		return
+	}
+
+	fields := strings.Fields(token.Value)
+	if len(fields) == 0 || fields[0] != versionDirective {
+		// Not a version directive (e.g. #!/usr/bin/robolang), so treat it like a comment
+		return
+	}
+	if p.started {
+		p.result.addError(newParseError(token, "The language version must be declared before any statements"))
+		return
+	}
+	if !p.result.LanguageVersion.IsZero() {
+		p.result.addError(newParseError(token, "The language version has already been declared"))
+		return
+	}
+	if len(fields) != 2 {
+		p.result.addError(newParseError(token, "Invalid version directive, expected #! robolang major.minor"))
+		return
+	}
+
+	version, err := ParseVersion(fields[1])
+	if err != nil {
+		p.result.addError(newParseError(token, "%v", err))
+		return
+	}
+	if CurrentVersion.Less(version) {
+		p.result.addError(newParseError(token, "The script requires robolang %s, but only %s is supported", version, CurrentVersion))
+	}
+	p.result.LanguageVersion = version
+}
@@ -0,0 +1,93 @@
+package robolang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Version
+		valid    bool
+	}{
+		{"1.0", Version{1, 0}, true},
+		{"1.12", Version{1, 12}, true},
+		{"1", Version{}, false},
+		{"1.x", Version{}, false},
+		{"1.2.3", Version{}, false},
+		{"-1.2", Version{}, false},
+	}
+	for _, test := range tests {
+		actual, err := ParseVersion(test.input)
+		if (err == nil) != test.valid || actual != test.expected {
+			t.Errorf("Unexpected version for %s: expected %v (valid %v), got %v (%v)", test.input, test.expected, test.valid, actual, err)
+		}
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	if !(Version{1, 0}).Less(Version{1, 1}) || !(Version{1, 9}).Less(Version{2, 0}) || (Version{1, 1}).Less(Version{1, 1}) {
+		t.Errorf("Version comparison is incorrect")
+	}
+}
+
+func TestMinimumVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		features string
+	}{
+		{"clear()", "1.0", ""},
+		{"waitForTime(duration=5m)", "1.0", ""},
+		{"move(distance=30cm)", "1.1", FeatureQuantities},
+		{"say(text='Hi {&name}')", "1.1", FeatureTemplates},
+		{"set(\n  variable=&count,\n  value=1,\n)", "1.1", FeatureMultiLineArgs + "," + FeatureTrailingComma},
+		{"say(text='''hello''')", "1.1", FeatureMultiLineText},
+		{"script(name='Test')\nclear()", "1.1", FeatureScriptHeader},
+	}
+	for _, test := range tests {
+		result := NewParser(test.input).Parse()
+		if len(result.Errors) > 0 {
+			t.Errorf("Unexpected errors while parsing `%s`: [%v]", test.input, result.Errors)
+			continue
+		}
+		if actual := result.MinimumVersion().String(); actual != test.expected {
+			t.Errorf("Unexpected minimum version for `%s`: expected %s, got %s", test.input, test.expected, actual)
+		}
+		if actual := strings.Join(result.UsedFeatures(), ","); actual != test.features {
+			t.Errorf("Unexpected features for `%s`: expected [%s], got [%s]", test.input, test.features, actual)
+		}
+	}
+}
+
+func TestVersionDirective(t *testing.T) {
+	tests := []struct {
+		input    string
+		version  string
+		expected string
+	}{
+		{"#! robolang 1.0\nclear()", "1.0", ""},
+		{"# Patrol script\n#! robolang 1.1\nmove(distance=30cm)", "1.1", ""},
+		{"#!/usr/bin/env robolang\nclear()", "0.0", ""},
+		{"#! robolang 1.0\nmove(distance=30cm)", "1.0", "Using quantity literals requires robolang 1.1, but the script declares 1.0 at line 1, pos 14"},
+		{"script(language='1.0')\nclear()", "1.0", "Using script header requires robolang 1.1, but the script declares 1.0 at line 0, pos 0"},
+		{"#! robolang 9.0\nclear()", "9.0", "The script requires robolang 9.0, but only " + CurrentVersion.String() + " is supported at line 0, pos 0"},
+		{"clear()\n#! robolang 1.0", "0.0", "The language version must be declared before any statements at line 1, pos 0"},
+		{"#! robolang 1.0\n#! robolang 1.1\nclear()", "1.0", "The language version has already been declared at line 1, pos 0"},
+		{"#! robolang one\nclear()", "0.0", "Invalid language version 'one', expected major.minor at line 0, pos 0"},
+	}
+	for _, test := range tests {
+		result := NewParser(test.input).Parse()
+		errs := ""
+		for _, err := range result.Errors {
+			errs += err.Error()
+		}
+		if errs != test.expected {
+			t.Errorf("Unexpected errors for `%s`: expected [%s], got [%s]", test.input, test.expected, errs)
+		}
+		if actual := result.LanguageVersion.String(); actual != test.version {
+			t.Errorf("Unexpected language version for `%s`: expected %s, got %s", test.input, test.version, actual)
+		}
+	}
+}